@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bombsimon/logrusr/v3"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/fsnotify.v1"
 
+	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
 	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowconfig "k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/config/secret"
 	"k8s.io/test-infra/prow/flagutil"
 	configflagutil "k8s.io/test-infra/prow/flagutil/config"
@@ -24,6 +34,7 @@ import (
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/pjutil/pprof"
 	controllerruntime "sigs.k8s.io/controller-runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	imagev1 "github.com/openshift/api/image/v1"
@@ -79,10 +90,28 @@ type testImagesDistributorOptions struct {
 	additionalImageStreams             sets.String
 	additionalImageStreamNamespacesRaw flagutil.Strings
 	additionalImageStreamNamespaces    sets.String
+	namespaceGlobsRaw                  flagutil.Strings
+	skipNamespacePatternsRaw           flagutil.Strings
 	forbiddenRegistriesRaw             flagutil.Strings
 	forbiddenRegistries                sets.String
 	ignoreClusterNamesRaw              flagutil.Strings
 	ignoreClusterNames                 sets.String
+	resyncTokenPath                    string
+	copiedAnnotationPrefixesRaw        flagutil.Strings
+	destinationNamespaceFormat         string
+	caBundleSourceRaw                  string
+	destinationTagsRaw                 flagutil.Strings
+	deniedDigestsPath                  string
+	once                               bool
+	dumpState                          bool
+	pauseConfigMapRaw                  string
+	defaultReferencePolicyRaw          string
+	clusterReferencePoliciesRaw        flagutil.Strings
+	namespaceReferencePoliciesRaw      flagutil.Strings
+	clusterPrioritiesRaw               flagutil.Strings
+	propagatedImageLabelsRaw           flagutil.Strings
+	// distribution holds the completed options of the distribution itself
+	distribution testimagesdistributor.Options
 }
 
 type imagePusherOptions struct {
@@ -112,8 +141,46 @@ func newOpts() (*options, error) {
 	fs.Var(&opts.testImagesDistributorOptions.additionalImageStreamTagsRaw, "testImagesDistributorOptions.additional-image-stream-tag", "An imagestreamtag that will be distributed even if no test explicitly references it. It must be in namespace/name:tag format (e.G `ci/clonerefs:latest`). Can be passed multiple times.")
 	fs.Var(&opts.testImagesDistributorOptions.additionalImageStreamsRaw, "testImagesDistributorOptions.additional-image-stream", "An imagestream that will be distributed even if no test explicitly references it. It must be in namespace/name format (e.G `ci/clonerefs`). Can be passed multiple times.")
 	fs.Var(&opts.testImagesDistributorOptions.additionalImageStreamNamespacesRaw, "testImagesDistributorOptions.additional-image-stream-namespace", "A namespace in which imagestreams will be distributed even if no test explicitly references them (e.G `ci`). Can be passed multiple times.")
-	fs.Var(&opts.testImagesDistributorOptions.forbiddenRegistriesRaw, "testImagesDistributorOptions.forbidden-registry", "The hostname of an image registry from which there is no synchronization of its images. Can be passed multiple times.")
+	fs.Var(&opts.testImagesDistributorOptions.namespaceGlobsRaw, "testImagesDistributorOptions.image-stream-namespace-glob", "A path-style glob pattern (e.G `ci-op-*`). Imagestreams in all namespaces that match it will be distributed even if no test explicitly references them. Can be passed multiple times.")
+	fs.Var(&opts.testImagesDistributorOptions.skipNamespacePatternsRaw, "testImagesDistributorOptions.skip-image-stream-namespace-pattern", "A regular expression (e.G `^openshift-`). Imagestreams in namespaces that match it will never be distributed, regardless of any other option. Can be passed multiple times.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.DenyByDefault, "testImagesDistributorOptions.deny-by-default", false, "If set, only imagestreamtags that match an additional imagestreamtag, imagestream, namespace or namespace glob are distributed. Being referenced by tests or living in a multiarch namespace is not enough then.")
+	fs.Var(&opts.testImagesDistributorOptions.forbiddenRegistriesRaw, "testImagesDistributorOptions.forbidden-registry", "The hostname of an image registry from which there is no synchronization of its images, with an optional port that is ignored when matching. If it has a path (e.G `quay.io/openshift`), only the repositories starting with it are not synchronized. Can be passed multiple times.")
 	fs.Var(&opts.testImagesDistributorOptions.ignoreClusterNamesRaw, "testImagesDistributorOptions.ignore-cluster-name", "The cluster name to which there is no synchronization of test images. Can be passed multiple times.")
+	fs.StringVar(&opts.testImagesDistributorOptions.resyncTokenPath, "testImagesDistributorOptions.resync-token-path", "", "Path to a file holding the bearer token for the endpoint to force the resync of an imagestreamtag or all tags of an imagestream. Only the leader accepts resyncs. The endpoint is disabled if unset.")
+	fs.DurationVar(&opts.testImagesDistributorOptions.distribution.PeriodicResyncInterval, "testImagesDistributorOptions.periodic-resync-interval", 0, "Interval in which all imagestreamtags get resynced, regardless of watch events. A jitter is added to it. Disabled if zero.")
+	fs.IntVar(&opts.testImagesDistributorOptions.distribution.MaxConcurrentReconciles, "testImagesDistributorOptions.max-concurrent-reconciles", 1, "The number of imagestreamtags that get reconciled in parallel.")
+	fs.Var(&opts.testImagesDistributorOptions.copiedAnnotationPrefixesRaw, "testImagesDistributorOptions.copied-annotation-prefix", "A prefix of imagestream annotations that will be copied to the build clusters. Can be passed multiple times. Defaults to release.openshift.io/config.")
+	fs.StringVar(&opts.testImagesDistributorOptions.destinationNamespaceFormat, "testImagesDistributorOptions.destination-namespace-format", "", "The namespace imagestreamtags get imported into on the build clusters, {cluster} and {namespace} get replaced by the name of the build cluster and the namespace of the source (e.G `{cluster}-{namespace}`). Defaults to the namespace of the source.")
+	fs.StringVar(&opts.testImagesDistributorOptions.distribution.Requester, "testImagesDistributorOptions.requester", "", fmt.Sprintf("The value of the %s annotation of the namespaces that get created on the build clusters. Useful to tell multiple instances apart. Defaults to %s.", api.DPTPRequesterLabel, testimagesdistributor.ControllerName))
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.PruneRemovedTags, "testImagesDistributorOptions.prune-removed-tags", false, "If set, imagestreamtags that got removed from their imagestream on the registry cluster get deleted on the build clusters as well.")
+	fs.DurationVar(&opts.testImagesDistributorOptions.distribution.ImportTimeout, "testImagesDistributorOptions.import-timeout", 0, "The time the build clusters get to return the status of an import before it counts as failed and gets retried. Unlimited if zero.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.ScheduledImports, "testImagesDistributorOptions.scheduled-imports", false, "If set, the imported tags get periodically re-imported by the image import scheduler of the build clusters.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.DisableLocalLookup, "testImagesDistributorOptions.disable-local-lookup", false, "If set, the imagestreams on the build clusters do not resolve references in pods to their tags.")
+	fs.StringVar(&opts.testImagesDistributorOptions.caBundleSourceRaw, "testImagesDistributorOptions.ca-bundle-configmap", "", "A configmap on the build clusters holding the CA bundle of the registry, in namespace/name format (e.G `ci/registry-ca`). It gets copied into all namespaces images are imported into. Nothing is copied if unset.")
+	fs.Var(&opts.testImagesDistributorOptions.destinationTagsRaw, "testImagesDistributorOptions.destination-tag", "A mapping of a source tag to the tag it gets imported as on the build clusters in source=destination format (e.G `latest=stable`). Can be passed multiple times.")
+	fs.StringVar(&opts.testImagesDistributorOptions.deniedDigestsPath, "testImagesDistributorOptions.denied-digests-path", "", "Path to a file holding the digests of images that must never be distributed, one per line. Changes to it take effect without a restart.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.PropagateSourceCommit, "testImagesDistributorOptions.propagate-source-commit", false, "If set, the imported tags get annotated with the commit the source image was built from.")
+	fs.DurationVar(&opts.testImagesDistributorOptions.distribution.MinImageAge, "testImagesDistributorOptions.min-image-age", 0, "The age images need to reach before they get distributed, so images that get rolled back right away are not. Disabled if zero.")
+	fs.StringVar(&opts.testImagesDistributorOptions.defaultReferencePolicyRaw, "testImagesDistributorOptions.default-reference-policy", string(imagev1.LocalTagReferencePolicy), fmt.Sprintf("The reference policy of the imported tags, either %s or %s.", imagev1.LocalTagReferencePolicy, imagev1.SourceTagReferencePolicy))
+	fs.Var(&opts.testImagesDistributorOptions.clusterReferencePoliciesRaw, "testImagesDistributorOptions.cluster-reference-policy", "The reference policy of the tags imported into a build cluster in cluster=policy format (e.G `build01=Source`). Overrides the default. Can be passed multiple times.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.dumpState, "testImagesDistributorOptions.dump-state", false, "If set, the digests and creation timestamps of all test images on the registry cluster and all clusters they get distributed to are written to stdout as JSON and the process exits rather than running the controllers.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.once, "testImagesDistributorOptions.once", false, "If set, all test images get distributed once to all clusters except the registry cluster and the process exits rather than running the controllers. It exits non-zero if any distribution failed.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.PropagateLookupPolicy, "testImagesDistributorOptions.propagate-lookup-policy", false, "If set, the imagestreams on the build clusters only resolve references in pods to their tags if their source imagestream does. Mutually exclusive with --testImagesDistributorOptions.disable-local-lookup.")
+	fs.StringVar(&opts.testImagesDistributorOptions.distribution.ManagedByAnnotation, "testImagesDistributorOptions.managed-by-annotation", "", "The key of the annotation that marks the imagestreams on the build clusters as managed by this controller. Defaults to dptp.openshift.io/managed-by if unset.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.CopySignatures, "testImagesDistributorOptions.copy-signatures", false, "If set, the signatures of the source images get created on the build clusters after the import.")
+	fs.IntVar(&opts.testImagesDistributorOptions.distribution.BulkReconcileWorkers, "testImagesDistributorOptions.bulk-reconcile-workers", 1, "The number of imagestreamtags --testImagesDistributorOptions.once reconciles in parallel.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.CompareContentDigest, "testImagesDistributorOptions.compare-content-digest", false, "If set, the images on the build clusters count as current if they have the same content digest annotation as the source image, even if their digests differ.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.DisableAnnotationCopying, "testImagesDistributorOptions.disable-annotation-copying", false, "If set, no annotations get copied from the source imagestreams and the ones that got copied before are removed from the build clusters. Mutually exclusive with --testImagesDistributorOptions.copied-annotation-prefix.")
+	fs.StringVar(&opts.testImagesDistributorOptions.pauseConfigMapRaw, "testImagesDistributorOptions.pause-configmap", "", "A configmap on the registry cluster in namespace/name format (e.G `ci/test-images-distributor`). All distribution is paused while its `paused` key is set to `true`. Never paused if unset.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.CopyTagAnnotations, "testImagesDistributorOptions.copy-tag-annotations", false, "If set, the annotations of the source imagestreamtags that match the copied annotation prefixes get set on the imported tags.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.SkipNewerDestinations, "testImagesDistributorOptions.skip-newer-destinations", false, "If set, tags on the build clusters do not get replaced by older source images, e.G. during rollbacks. Source imagestreamtags annotated with dptp.openshift.io/force-sync=true are always distributed.")
+	fs.Var(&opts.testImagesDistributorOptions.namespaceReferencePoliciesRaw, "testImagesDistributorOptions.namespace-reference-policy", "The reference policy of the tags imported from a namespace of the registry cluster in namespace=policy format (e.G `ocp=Source`). Overrides the default and the cluster reference policies. Can be passed multiple times.")
+	fs.Var(&opts.testImagesDistributorOptions.clusterPrioritiesRaw, "testImagesDistributorOptions.cluster-priority", "The priority of a build cluster in cluster=priority format (e.G `build01=10`). --testImagesDistributorOptions.once reconciles clusters with a higher priority first. Unlisted clusters have a priority of zero. Can be passed multiple times.")
+	fs.BoolVar(&opts.testImagesDistributorOptions.distribution.RequirePriorityClusterSuccess, "testImagesDistributorOptions.require-priority-cluster-success", false, "If set, --testImagesDistributorOptions.once does not reconcile clusters with a lower priority if reconciling the ones with a higher priority failed.")
+	fs.DurationVar(&opts.testImagesDistributorOptions.distribution.DestinationTTL, "testImagesDistributorOptions.destination-ttl", 0, "If set, the imagestreams on the build clusters get annotated with a time this far in the future whenever they are reconciled, so imagestreams that stopped getting synced can be pruned. Nothing is annotated if zero.")
+	fs.StringVar(&opts.testImagesDistributorOptions.distribution.ReleasePayloadAnnotation, "testImagesDistributorOptions.release-payload-annotation", "", "The key of the annotation that marks imagestreams on the registry cluster as release payloads, which are never distributed. Defaults to release.openshift.io/source if unset.")
+	fs.Var(&opts.testImagesDistributorOptions.propagatedImageLabelsRaw, "testImagesDistributorOptions.propagated-image-label", "The key of a label of the source images that gets set as annotation on the imported tags. Can be passed multiple times.")
+	fs.IntVar(&opts.testImagesDistributorOptions.distribution.MaxImportsPerRun, "testImagesDistributorOptions.max-imports-per-run", 0, "The maximum number of imports a single --testImagesDistributorOptions.once run creates. Unlimited if zero.")
 	fs.DurationVar(&opts.blockProfileRate, "block-profile-rate", time.Duration(0), "The block profile rate. Set to non-zero to enable.")
 	fs.StringVar(&opts.registryClusterName, "registry-cluster-name", "app.ci", "the cluster name on which the CI central registry is running")
 	fs.Var(&opts.serviceAccountSecretRefresherOptions.enabledNamespaces, "serviceAccountRefresherOptions.enabled-namespace", "A namespace for which the serviceaccount_secret_refresher should be enabled. Can be passed multiple times.")
@@ -173,13 +240,106 @@ func newOpts() (*options, error) {
 	opts.testImagesDistributorOptions.additionalImageStreams = imageStreams
 
 	opts.testImagesDistributorOptions.additionalImageStreamNamespaces = completeSet(opts.testImagesDistributorOptions.additionalImageStreamNamespacesRaw)
-	opts.testImagesDistributorOptions.forbiddenRegistries = completeSet(opts.testImagesDistributorOptions.forbiddenRegistriesRaw)
+	namespaceGlobs, globErrors := completeNamespaceGlobs("testImagesDistributorOptions.image-stream-namespace-glob", opts.testImagesDistributorOptions.namespaceGlobsRaw)
+	errs = append(errs, globErrors...)
+	opts.testImagesDistributorOptions.distribution.NamespaceGlobs = namespaceGlobs
+	skipNamespacePatterns, patternErrors := completeRegexps("testImagesDistributorOptions.skip-image-stream-namespace-pattern", opts.testImagesDistributorOptions.skipNamespacePatternsRaw)
+	errs = append(errs, patternErrors...)
+	opts.testImagesDistributorOptions.distribution.SkipNamespacePatterns = skipNamespacePatterns
+	forbiddenRegistries, registryErrors := completeRegistryHosts("testImagesDistributorOptions.forbidden-registry", opts.testImagesDistributorOptions.forbiddenRegistriesRaw)
+	errs = append(errs, registryErrors...)
+	opts.testImagesDistributorOptions.forbiddenRegistries = forbiddenRegistries
 	opts.testImagesDistributorOptions.ignoreClusterNames = completeSet(opts.testImagesDistributorOptions.ignoreClusterNamesRaw)
+	copiedAnnotationPrefixes, prefixErrors := completeAnnotationPrefixes("testImagesDistributorOptions.copied-annotation-prefix", opts.testImagesDistributorOptions.copiedAnnotationPrefixesRaw)
+	errs = append(errs, prefixErrors...)
+	opts.testImagesDistributorOptions.distribution.CopiedAnnotationPrefixes = copiedAnnotationPrefixes
+	destinationNamespace, err := completeDestinationNamespaceFormat("testImagesDistributorOptions.destination-namespace-format", opts.testImagesDistributorOptions.destinationNamespaceFormat)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	opts.testImagesDistributorOptions.distribution.DestinationNamespace = destinationNamespace
+	if opts.testImagesDistributorOptions.distribution.ImportTimeout < 0 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.import-timeout must not be negative"))
+	}
+	caBundleSource, err := completeNamespacedName("testImagesDistributorOptions.ca-bundle-configmap", opts.testImagesDistributorOptions.caBundleSourceRaw)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	opts.testImagesDistributorOptions.distribution.CABundleSource = caBundleSource
+	destinationTag, tagErrors := completeTagMapping("testImagesDistributorOptions.destination-tag", opts.testImagesDistributorOptions.destinationTagsRaw)
+	errs = append(errs, tagErrors...)
+	opts.testImagesDistributorOptions.distribution.DestinationTag = destinationTag
+	if opts.testImagesDistributorOptions.distribution.MinImageAge < 0 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.min-image-age must not be negative"))
+	}
+	defaultReferencePolicy, err := completeReferencePolicy("testImagesDistributorOptions.default-reference-policy", opts.testImagesDistributorOptions.defaultReferencePolicyRaw)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	opts.testImagesDistributorOptions.distribution.DefaultReferencePolicy = defaultReferencePolicy
+	clusterReferencePolicies, policyErrors := completeReferencePolicies("testImagesDistributorOptions.cluster-reference-policy", opts.testImagesDistributorOptions.clusterReferencePoliciesRaw)
+	errs = append(errs, policyErrors...)
+	opts.testImagesDistributorOptions.distribution.ReferencePolicies = clusterReferencePolicies
+	namespaceReferencePolicies, policyErrors := completeReferencePolicies("testImagesDistributorOptions.namespace-reference-policy", opts.testImagesDistributorOptions.namespaceReferencePoliciesRaw)
+	errs = append(errs, policyErrors...)
+	opts.testImagesDistributorOptions.distribution.NamespaceReferencePolicies = namespaceReferencePolicies
+	if opts.testImagesDistributorOptions.distribution.PropagateLookupPolicy && opts.testImagesDistributorOptions.distribution.DisableLocalLookup {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.propagate-lookup-policy and --testImagesDistributorOptions.disable-local-lookup are mutually exclusive"))
+	}
+	if annotation := opts.testImagesDistributorOptions.distribution.ManagedByAnnotation; annotation != "" {
+		if invalid := validation.IsQualifiedName(annotation); len(invalid) > 0 {
+			errs = append(errs, fmt.Errorf("--testImagesDistributorOptions.managed-by-annotation value %s is not a valid annotation key: %s", annotation, strings.Join(invalid, ", ")))
+		}
+	}
+	if opts.testImagesDistributorOptions.distribution.BulkReconcileWorkers < 1 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.bulk-reconcile-workers must be at least 1"))
+	}
+	if opts.testImagesDistributorOptions.distribution.DisableAnnotationCopying && len(opts.testImagesDistributorOptions.copiedAnnotationPrefixesRaw.Strings()) > 0 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.disable-annotation-copying and --testImagesDistributorOptions.copied-annotation-prefix are mutually exclusive"))
+	}
+	pauseConfigMap, err := completeNamespacedName("testImagesDistributorOptions.pause-configmap", opts.testImagesDistributorOptions.pauseConfigMapRaw)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	opts.testImagesDistributorOptions.distribution.PauseConfigMap = pauseConfigMap
+	clusterPriorities, priorityErrors := completeClusterPriorities("testImagesDistributorOptions.cluster-priority", opts.testImagesDistributorOptions.clusterPrioritiesRaw)
+	errs = append(errs, priorityErrors...)
+	opts.testImagesDistributorOptions.distribution.ClusterPriority = clusterPriorities
+	if opts.testImagesDistributorOptions.distribution.DestinationTTL < 0 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.destination-ttl must not be negative"))
+	}
+	if annotation := opts.testImagesDistributorOptions.distribution.ReleasePayloadAnnotation; annotation != "" {
+		if invalid := validation.IsQualifiedName(annotation); len(invalid) > 0 {
+			errs = append(errs, fmt.Errorf("--testImagesDistributorOptions.release-payload-annotation value %s is not a valid annotation key: %s", annotation, strings.Join(invalid, ", ")))
+		}
+	}
+	for _, label := range opts.testImagesDistributorOptions.propagatedImageLabelsRaw.Strings() {
+		if invalid := validation.IsQualifiedName(label); len(invalid) > 0 {
+			errs = append(errs, fmt.Errorf("--testImagesDistributorOptions.propagated-image-label value %s is not a valid annotation key: %s", label, strings.Join(invalid, ", ")))
+		}
+	}
+	opts.testImagesDistributorOptions.distribution.PropagatedImageLabels = opts.testImagesDistributorOptions.propagatedImageLabelsRaw.Strings()
+	if opts.testImagesDistributorOptions.distribution.MaxImportsPerRun < 0 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.max-imports-per-run must not be negative"))
+	}
+	if opts.testImagesDistributorOptions.distribution.MaxConcurrentReconciles < 1 {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.max-concurrent-reconciles must be at least 1"))
+	}
 
 	imagePusherImageStreams, isErrors := completeImageStream("uniRegistrySyncerOptions.image-stream", opts.imagePusherOptions.imageStreamsRaw)
 	errs = append(errs, isErrors...)
 	opts.imagePusherOptions.imageStreams = imagePusherImageStreams
 
+	if opts.testImagesDistributorOptions.once && !opts.enabledControllersSet.Has(testimagesdistributor.ControllerName) {
+		errs = append(errs, fmt.Errorf("--testImagesDistributorOptions.once requires the %s controller to be enabled", testimagesdistributor.ControllerName))
+	}
+	if opts.testImagesDistributorOptions.dumpState && !opts.enabledControllersSet.Has(testimagesdistributor.ControllerName) {
+		errs = append(errs, fmt.Errorf("--testImagesDistributorOptions.dump-state requires the %s controller to be enabled", testimagesdistributor.ControllerName))
+	}
+	if opts.testImagesDistributorOptions.dumpState && opts.testImagesDistributorOptions.once {
+		errs = append(errs, errors.New("--testImagesDistributorOptions.dump-state and --testImagesDistributorOptions.once are mutually exclusive"))
+	}
+
 	if opts.enabledControllersSet.Has(testimagesdistributor.ControllerName) && opts.stepConfigPath == "" {
 		errs = append(errs, fmt.Errorf("--step-config-path is required when the %s controller is enabled", testimagesdistributor.ControllerName))
 	}
@@ -235,6 +395,237 @@ func completeImageStream(name string, raw flagutil.Strings) (sets.String, []erro
 	return imageStreams, errs
 }
 
+func completeNamespaceGlobs(name string, raw flagutil.Strings) ([]string, []error) {
+	var globs []string
+	var errs []error
+	for _, val := range raw.Strings() {
+		if _, err := path.Match(val, ""); err != nil {
+			errs = append(errs, fmt.Errorf("--%s value %s is not a valid glob: %w", name, val, err))
+			continue
+		}
+		globs = append(globs, val)
+	}
+	return globs, errs
+}
+
+func completeRegexps(name string, raw flagutil.Strings) ([]*regexp.Regexp, []error) {
+	var regexps []*regexp.Regexp
+	var errs []error
+	for _, val := range raw.Strings() {
+		re, err := regexp.Compile(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--%s value %s is not a valid regular expression: %w", name, val, err))
+			continue
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, errs
+}
+
+func completeAnnotationPrefixes(name string, raw flagutil.Strings) ([]string, []error) {
+	var prefixes []string
+	var errs []error
+	for _, val := range raw.Strings() {
+		if strings.TrimSpace(val) == "" {
+			errs = append(errs, fmt.Errorf("--%s must not be empty", name))
+			continue
+		}
+		prefixes = append(prefixes, val)
+	}
+	return prefixes, errs
+}
+
+// completeRegistryHosts returns the registry hosts, with an optional port and path. Ports are
+// ignored when matching, paths restrict the match to the repositories starting with them.
+func completeRegistryHosts(name string, raw flagutil.Strings) (sets.String, []error) {
+	hosts := sets.String{}
+	var errs []error
+	for _, val := range raw.Strings() {
+		registry := strings.TrimSuffix(val, "/")
+		if registry == "" || strings.HasPrefix(registry, "/") {
+			errs = append(errs, fmt.Errorf("--%s value %s does not start with a registry host", name, val))
+			continue
+		}
+		hosts.Insert(registry)
+	}
+	return hosts, errs
+}
+
+// completeTagMapping returns a function that maps the tags according to the source=destination pairs.
+// Tags without a mapping are kept. Every destination can only have one source, otherwise the tags
+// would overwrite each other.
+func completeTagMapping(name string, raw flagutil.Strings) (func(string) string, []error) {
+	mapping := map[string]string{}
+	destinations := sets.String{}
+	var errs []error
+	for _, val := range raw.Strings() {
+		equalSplit := strings.Split(val, "=")
+		if len(equalSplit) != 2 || equalSplit[0] == "" || equalSplit[1] == "" {
+			errs = append(errs, fmt.Errorf("--%s value %s was not in source=destination format", name, val))
+			continue
+		}
+		source, destination := equalSplit[0], equalSplit[1]
+		if _, duplicate := mapping[source]; duplicate {
+			errs = append(errs, fmt.Errorf("--%s maps tag %s more than once", name, source))
+			continue
+		}
+		if destinations.Has(destination) {
+			errs = append(errs, fmt.Errorf("--%s maps more than one tag to %s", name, destination))
+			continue
+		}
+		mapping[source] = destination
+		destinations.Insert(destination)
+	}
+	if len(mapping) == 0 {
+		return nil, errs
+	}
+	return func(tag string) string {
+		if destination, mapped := mapping[tag]; mapped {
+			return destination
+		}
+		return tag
+	}, errs
+}
+
+// deniedDigestsLoader holds the digests listed in a file, one per line. Empty lines and
+// comments starting with # are ignored. The file is only parsed when it changes. Contrary
+// to the secret agent, the digests are not censored in the logs.
+type deniedDigestsLoader struct {
+	path    string
+	lock    sync.RWMutex
+	digests sets.String
+}
+
+// load parses the file and replaces the digests with its content
+func (l *deniedDigestsLoader) load() error {
+	raw, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read denied digests from %s: %w", l.path, err)
+	}
+	digests := sets.String{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			digests.Insert(line)
+		}
+	}
+	l.lock.Lock()
+	l.digests = digests
+	l.lock.Unlock()
+	return nil
+}
+
+// get returns the digests of the last successful load
+func (l *deniedDigestsLoader) get() sets.String {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.digests
+}
+
+// watch returns a function that reloads the digests whenever the directory of the file
+// changes, handling both configmap mounts and plain directories
+func (l *deniedDigestsLoader) watch() (func(context.Context), error) {
+	dir := filepath.Dir(l.path)
+	errFunc := func(err error, msg string) {
+		logrus.WithError(err).WithField("path", l.path).Error(msg)
+	}
+	isCMMount, err := prowconfig.IsConfigMapMount(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if %s is a configmap mount: %w", dir, err)
+	}
+	if isCMMount {
+		return prowconfig.GetCMMountWatcher(l.load, errFunc, dir)
+	}
+	return prowconfig.GetFileWatcher(func(*fsnotify.Watcher) error { return l.load() }, errFunc, dir)
+}
+
+func completeReferencePolicy(name, raw string) (imagev1.TagReferencePolicyType, error) {
+	switch policy := imagev1.TagReferencePolicyType(raw); policy {
+	case imagev1.LocalTagReferencePolicy, imagev1.SourceTagReferencePolicy:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("--%s value %s is not a reference policy, must be one of %s or %s", name, raw, imagev1.LocalTagReferencePolicy, imagev1.SourceTagReferencePolicy)
+	}
+}
+
+// completeReferencePolicies parses key=policy pairs
+func completeReferencePolicies(name string, raw flagutil.Strings) (map[string]imagev1.TagReferencePolicyType, []error) {
+	policies := map[string]imagev1.TagReferencePolicyType{}
+	var errs []error
+	for _, val := range raw.Strings() {
+		equalSplit := strings.Split(val, "=")
+		if len(equalSplit) != 2 || equalSplit[0] == "" {
+			errs = append(errs, fmt.Errorf("--%s value %s was not in key=policy format", name, val))
+			continue
+		}
+		if _, duplicate := policies[equalSplit[0]]; duplicate {
+			errs = append(errs, fmt.Errorf("--%s sets the reference policy of %s more than once", name, equalSplit[0]))
+			continue
+		}
+		policy, err := completeReferencePolicy(name, equalSplit[1])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		policies[equalSplit[0]] = policy
+	}
+	return policies, errs
+}
+
+// completeClusterPriorities parses the priorities of build clusters in cluster=priority format
+func completeClusterPriorities(name string, raw flagutil.Strings) (map[string]int, []error) {
+	priorities := map[string]int{}
+	var errs []error
+	for _, val := range raw.Strings() {
+		equalSplit := strings.Split(val, "=")
+		if len(equalSplit) != 2 || equalSplit[0] == "" {
+			errs = append(errs, fmt.Errorf("--%s value %s was not in cluster=priority format", name, val))
+			continue
+		}
+		if _, duplicate := priorities[equalSplit[0]]; duplicate {
+			errs = append(errs, fmt.Errorf("--%s sets the priority of %s more than once", name, equalSplit[0]))
+			continue
+		}
+		priority, err := strconv.Atoi(equalSplit[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("--%s value %s does not have an integer priority", name, val))
+			continue
+		}
+		priorities[equalSplit[0]] = priority
+	}
+	return priorities, errs
+}
+
+// completeNamespacedName parses an optional object reference in namespace/name format
+func completeNamespacedName(name, raw string) (*types.NamespacedName, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	slashSplit := strings.Split(raw, "/")
+	if len(slashSplit) != 2 || slashSplit[0] == "" || slashSplit[1] == "" {
+		return nil, fmt.Errorf("--%s value %s was not in namespace/name format", name, raw)
+	}
+	return &types.NamespacedName{Namespace: slashSplit[0], Name: slashSplit[1]}, nil
+}
+
+// completeDestinationNamespaceFormat returns a function that fills the placeholders of the format.
+// The format must contain the namespace, otherwise imagestreams of different namespaces would overwrite
+// each other.
+func completeDestinationNamespaceFormat(name, format string) (func(cluster, namespace string) string, error) {
+	if format == "" {
+		return nil, nil
+	}
+	if !strings.Contains(format, "{namespace}") {
+		return nil, fmt.Errorf("--%s value %s must contain {namespace}", name, format)
+	}
+	fill := func(cluster, namespace string) string {
+		return strings.NewReplacer("{cluster}", cluster, "{namespace}", namespace).Replace(format)
+	}
+	if errs := validation.IsDNS1123Label(fill("cluster", "namespace")); len(errs) > 0 {
+		return nil, fmt.Errorf("--%s value %s does not result in valid namespace names: %s", name, format, strings.Join(errs, ", "))
+	}
+	return fill, nil
+}
+
 func completeSet(raw flagutil.Strings) sets.String {
 	result := sets.String{}
 	if vals := raw.Strings(); len(vals) > 0 {
@@ -245,6 +636,98 @@ func completeSet(raw flagutil.Strings) sets.String {
 	return result
 }
 
+// runTestImagesDistributorOnce distributes all test images once. The managers and their caches
+// are not started in this mode, so the clients talk to the apiservers directly.
+func runTestImagesDistributorOnce(ctx context.Context, opts *options, kubeconfigs map[string]rest.Config, configAgent agents.ConfigAgent, resolver agents.RegistryAgent) error {
+	registryClient, buildClusterClients, err := testImagesDistributorClients(opts, kubeconfigs)
+	if err != nil {
+		return err
+	}
+	distributorOpts := opts.testImagesDistributorOptions
+	summary, err := testimagesdistributor.RunOnce(
+		ctx,
+		opts.registryClusterName,
+		registryClient,
+		buildClusterClients,
+		distributorOpts.ignoreClusterNames,
+		testImagesDistributorFilterParams(opts, configAgent, resolver, buildClusterClients),
+		distributorOpts.forbiddenRegistries,
+		distributorOpts.distribution,
+	)
+	logrus.WithFields(logrus.Fields{
+		"reconciled": summary.Reconciled,
+		"imported":   summary.Imported,
+		"failed":     summary.Failed,
+		"deferred":   summary.Deferred,
+	}).Info("Distributed test images once")
+	return err
+}
+
+// dumpTestImagesDistributorState writes the state of all test images on all clusters to
+// stdout. Like in the once mode, the clients talk to the apiservers directly.
+func dumpTestImagesDistributorState(ctx context.Context, opts *options, kubeconfigs map[string]rest.Config, configAgent agents.ConfigAgent, resolver agents.RegistryAgent) error {
+	registryClient, buildClusterClients, err := testImagesDistributorClients(opts, kubeconfigs)
+	if err != nil {
+		return err
+	}
+	state, err := testimagesdistributor.DumpState(
+		ctx,
+		opts.registryClusterName,
+		registryClient,
+		buildClusterClients,
+		opts.testImagesDistributorOptions.ignoreClusterNames,
+		testImagesDistributorFilterParams(opts, configAgent, resolver, buildClusterClients),
+		opts.testImagesDistributorOptions.distribution,
+	)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
+
+// testImagesDistributorClients returns uncached clients for the registry cluster and
+// for the build clusters. The registry cluster is where the images get distributed
+// from, so just like in the controller mode, it is not one of the build clusters.
+func testImagesDistributorClients(opts *options, kubeconfigs map[string]rest.Config) (ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) {
+	var registryClient ctrlruntimeclient.Client
+	buildClusterClients := map[string]ctrlruntimeclient.Client{}
+	for cluster, cfg := range kubeconfigs {
+		cfg := cfg
+		client, err := ctrlruntimeclient.New(&cfg, ctrlruntimeclient.Options{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to construct client for cluster %s: %w", cluster, err)
+		}
+		if opts.dryRun {
+			client = ctrlruntimeclient.NewDryRunClient(client)
+		}
+		if cluster == opts.registryClusterName {
+			registryClient = client
+			continue
+		}
+		buildClusterClients[cluster] = client
+	}
+	return registryClient, buildClusterClients, nil
+}
+
+// testImagesDistributorFilterParams returns the parameters that select the test images in
+// the one-shot modes
+func testImagesDistributorFilterParams(opts *options, configAgent agents.ConfigAgent, resolver agents.RegistryAgent, buildClusterClients map[string]ctrlruntimeclient.Client) testimagesdistributor.FilterParams {
+	distributorOpts := opts.testImagesDistributorOptions
+	return testimagesdistributor.FilterParams{
+		ConfigAgent:                     configAgent,
+		Resolver:                        resolver,
+		AdditionalImageStreamTags:       distributorOpts.additionalImageStreamTags,
+		AdditionalImageStreams:          distributorOpts.additionalImageStreams,
+		AdditionalImageStreamNamespaces: distributorOpts.additionalImageStreamNamespaces,
+		NamespaceGlobs:                  distributorOpts.distribution.NamespaceGlobs,
+		SkipNamespacePatterns:           distributorOpts.distribution.SkipNamespacePatterns,
+		DenyByDefault:                   distributorOpts.distribution.DenyByDefault,
+		BuildClusterClients:             buildClusterClients,
+	}
+}
+
 func main() {
 	logrusutil.ComponentInit()
 	controllerruntime.SetLogger(logrusr.New(logrus.StandardLogger()))
@@ -418,6 +901,39 @@ func main() {
 		logrus.WithField("registriesExceptAppCI", registriesExceptAppCI.List()).Info("forbidden registries from build-farm clusters")
 		opts.testImagesDistributorOptions.forbiddenRegistries = opts.testImagesDistributorOptions.forbiddenRegistries.Union(registriesExceptAppCI)
 
+		if path := opts.testImagesDistributorOptions.resyncTokenPath; path != "" {
+			if err := secret.Add(path); err != nil {
+				logrus.WithError(err).Fatal("Failed to load the resync token")
+			}
+			opts.testImagesDistributorOptions.distribution.ResyncTokenGetter = secret.GetTokenGenerator(path)
+		}
+
+		if path := opts.testImagesDistributorOptions.deniedDigestsPath; path != "" {
+			loader := &deniedDigestsLoader{path: path}
+			if err := loader.load(); err != nil {
+				logrus.WithError(err).Fatal("Failed to load the denied digests")
+			}
+			watcher, err := loader.watch()
+			if err != nil {
+				logrus.WithError(err).Fatal("Failed to watch the denied digests")
+			}
+			go watcher(ctx)
+			opts.testImagesDistributorOptions.distribution.DeniedDigests = loader.get
+		}
+
+		if opts.testImagesDistributorOptions.once {
+			if err := runTestImagesDistributorOnce(ctx, opts, kubeconfigs, ciOPConfigAgent, registryConfigAgent); err != nil {
+				logrus.WithError(err).Fatal("Failed to distribute test images")
+			}
+			return
+		}
+		if opts.testImagesDistributorOptions.dumpState {
+			if err := dumpTestImagesDistributorState(ctx, opts, kubeconfigs, ciOPConfigAgent, registryConfigAgent); err != nil {
+				logrus.WithError(err).Fatal("Failed to dump the state of the test images")
+			}
+			return
+		}
+
 		if err := testimagesdistributor.AddToManager(
 			mgr,
 			opts.registryClusterName,
@@ -430,6 +946,7 @@ func main() {
 			opts.testImagesDistributorOptions.additionalImageStreamNamespaces,
 			opts.testImagesDistributorOptions.forbiddenRegistries,
 			opts.testImagesDistributorOptions.ignoreClusterNames,
+			opts.testImagesDistributorOptions.distribution,
 		); err != nil {
 			logrus.WithError(err).Fatal("failed to add testimagesdistributor")
 		}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/flagutil"
 
+	imagev1 "github.com/openshift/api/image/v1"
+
 	"github.com/openshift/ci-tools/pkg/testhelper"
 )
 
@@ -119,3 +124,420 @@ func TestCompleteSet(t *testing.T) {
 		})
 	}
 }
+
+func TestCompleteAnnotationPrefixes(t *testing.T) {
+	tests := []struct {
+		name           string
+		flagName       string
+		raw            flagutil.Strings
+		expected       []string
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			flagName: "some-flag",
+		},
+		{
+			name:     "some flags",
+			flagName: "some-flag",
+			raw:      flagutil.NewStrings([]string{"release.openshift.io/", "ci.openshift.io/"}...),
+			expected: []string{"release.openshift.io/", "ci.openshift.io/"},
+		},
+		{
+			name:           "empty prefix is rejected",
+			flagName:       "some-flag",
+			raw:            flagutil.NewStrings([]string{"release.openshift.io/", " "}...),
+			expected:       []string{"release.openshift.io/"},
+			expectedErrors: []error{fmt.Errorf("--some-flag must not be empty")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeAnnotationPrefixes(tc.flagName, tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteRegexps(t *testing.T) {
+	tests := []struct {
+		name           string
+		flagName       string
+		raw            flagutil.Strings
+		expected       []string
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			flagName: "some-flag",
+		},
+		{
+			name:     "valid regular expressions",
+			flagName: "some-flag",
+			raw:      flagutil.NewStrings([]string{"^openshift-", "^ci$"}...),
+			expected: []string{"^openshift-", "^ci$"},
+		},
+		{
+			name:           "malformed regular expression is rejected",
+			flagName:       "some-flag",
+			raw:            flagutil.NewStrings([]string{"^openshift-", "ci-[op"}...),
+			expected:       []string{"^openshift-"},
+			expectedErrors: []error{fmt.Errorf("--some-flag value ci-[op is not a valid regular expression: error parsing regexp: missing closing ]: `[op`")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeRegexps(tc.flagName, tc.raw)
+			var actualStrings []string
+			for _, re := range actual {
+				actualStrings = append(actualStrings, re.String())
+			}
+			if diff := cmp.Diff(tc.expected, actualStrings); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteNamespaceGlobs(t *testing.T) {
+	tests := []struct {
+		name           string
+		flagName       string
+		raw            flagutil.Strings
+		expected       []string
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			flagName: "some-flag",
+		},
+		{
+			name:     "valid globs",
+			flagName: "some-flag",
+			raw:      flagutil.NewStrings([]string{"ci-op-*", "ci"}...),
+			expected: []string{"ci-op-*", "ci"},
+		},
+		{
+			name:           "malformed glob is rejected",
+			flagName:       "some-flag",
+			raw:            flagutil.NewStrings([]string{"ci-op-*", "ci-[op"}...),
+			expected:       []string{"ci-op-*"},
+			expectedErrors: []error{fmt.Errorf("--some-flag value ci-[op is not a valid glob: syntax error in pattern")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeNamespaceGlobs(tc.flagName, tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteDestinationNamespaceFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		expected      string
+		expectedError error
+	}{
+		{
+			name: "unset keeps the namespace of the source",
+		},
+		{
+			name:     "cluster and namespace get filled in",
+			format:   "{cluster}-{namespace}",
+			expected: "build01-ci",
+		},
+		{
+			name:          "format without namespace",
+			format:        "{cluster}-mirror",
+			expectedError: fmt.Errorf("--some-flag value {cluster}-mirror must contain {namespace}"),
+		},
+		{
+			name:          "format resulting in invalid namespaces",
+			format:        "{namespace}_mirror",
+			expectedError: fmt.Errorf("--some-flag value {namespace}_mirror does not result in valid namespace names: a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fill, err := completeDestinationNamespaceFormat("some-flag", tc.format)
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Fatalf("error does not match expected, diff: %s", diff)
+			}
+			if tc.expected == "" {
+				if fill != nil {
+					t.Errorf("expected no mapping, got one resulting in %s", fill("build01", "ci"))
+				}
+				return
+			}
+			if actual := fill("build01", "ci"); actual != tc.expected {
+				t.Errorf("expected namespace %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompleteRegistryHosts(t *testing.T) {
+	tests := []struct {
+		name           string
+		raw            flagutil.Strings
+		expected       sets.String
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			expected: sets.NewString(),
+		},
+		{
+			name:     "hosts with and without port",
+			raw:      flagutil.NewStrings("quay.io", "registry.svc.ci.openshift.org:5000", "[::1]:5000", "registry.ci.openshift.org/"),
+			expected: sets.NewString("quay.io", "registry.svc.ci.openshift.org:5000", "[::1]:5000", "registry.ci.openshift.org"),
+		},
+		{
+			name:     "hosts with a path",
+			raw:      flagutil.NewStrings("quay.io/org", "quay.io/org/repo/", "registry.ci.openshift.org"),
+			expected: sets.NewString("quay.io/org", "quay.io/org/repo", "registry.ci.openshift.org"),
+		},
+		{
+			name:     "hosts with a port and a path",
+			raw:      flagutil.NewStrings("quay.io:443/org", "[::1]:5000/ci/"),
+			expected: sets.NewString("quay.io:443/org", "[::1]:5000/ci"),
+		},
+		{
+			name:           "values without a host",
+			raw:            flagutil.NewStrings("/", "/org", "registry.ci.openshift.org"),
+			expected:       sets.NewString("registry.ci.openshift.org"),
+			expectedErrors: []error{fmt.Errorf("--some-flag value / does not start with a registry host"), fmt.Errorf("--some-flag value /org does not start with a registry host")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeRegistryHosts("some-flag", tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteNamespacedName(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		expected      *types.NamespacedName
+		expectedError error
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "namespace and name",
+			raw:      "ci/registry-ca",
+			expected: &types.NamespacedName{Namespace: "ci", Name: "registry-ca"},
+		},
+		{
+			name:          "name only",
+			raw:           "registry-ca",
+			expectedError: fmt.Errorf("--some-flag value registry-ca was not in namespace/name format"),
+		},
+		{
+			name:          "empty namespace",
+			raw:           "/registry-ca",
+			expectedError: fmt.Errorf("--some-flag value /registry-ca was not in namespace/name format"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := completeNamespacedName("some-flag", tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteTagMapping(t *testing.T) {
+	tests := []struct {
+		name           string
+		raw            flagutil.Strings
+		expected       map[string]string
+		expectedErrors []error
+	}{
+		{
+			name: "no flags",
+		},
+		{
+			name:     "mapped tags are replaced, others are kept",
+			raw:      flagutil.NewStrings("latest=stable", "next=latest"),
+			expected: map[string]string{"latest": "stable", "next": "latest", "other": "other"},
+		},
+		{
+			name:     "invalid and conflicting mappings",
+			raw:      flagutil.NewStrings("latest", "latest=stable", "latest=other", "next=stable", "=stable"),
+			expected: map[string]string{"latest": "stable", "next": "next"},
+			expectedErrors: []error{
+				fmt.Errorf("--some-flag value latest was not in source=destination format"),
+				fmt.Errorf("--some-flag maps tag latest more than once"),
+				fmt.Errorf("--some-flag maps more than one tag to stable"),
+				fmt.Errorf("--some-flag value =stable was not in source=destination format"),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mapping, errs := completeTagMapping("some-flag", tc.raw)
+			if diff := cmp.Diff(tc.expectedErrors, errs, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+			if tc.expected == nil {
+				if mapping != nil {
+					t.Error("expected no mapping, got one")
+				}
+				return
+			}
+			actual := map[string]string{}
+			for tag := range tc.expected {
+				actual[tag] = mapping(tag)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDeniedDigestsLoader(t *testing.T) {
+	loader := &deniedDigestsLoader{path: filepath.Join(t.TempDir(), "denied-digests")}
+	for _, tc := range []struct {
+		content  string
+		expected sets.String
+	}{
+		{
+			content:  "sha256:abc\n\n# vulnerable, see the incident\n  sha256:def  \n",
+			expected: sets.NewString("sha256:abc", "sha256:def"),
+		},
+		{
+			content:  "sha256:def\n",
+			expected: sets.NewString("sha256:def"),
+		},
+	} {
+		if err := os.WriteFile(loader.path, []byte(tc.content), 0644); err != nil {
+			t.Fatalf("failed to write denied digests: %v", err)
+		}
+		if err := loader.load(); err != nil {
+			t.Fatalf("failed to load denied digests: %v", err)
+		}
+		if diff := cmp.Diff(tc.expected, loader.get()); diff != "" {
+			t.Errorf("actual does not match expected, diff: %s", diff)
+		}
+	}
+}
+
+func TestCompleteClusterPriorities(t *testing.T) {
+	tests := []struct {
+		name           string
+		raw            flagutil.Strings
+		expected       map[string]int
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			expected: map[string]int{},
+		},
+		{
+			name:     "priorities",
+			raw:      flagutil.NewStrings("build01=10", "build02=-1"),
+			expected: map[string]int{"build01": 10, "build02": -1},
+		},
+		{
+			name:     "invalid and duplicate priorities",
+			raw:      flagutil.NewStrings("build01", "build01=10", "build01=5", "build02=high"),
+			expected: map[string]int{"build01": 10},
+			expectedErrors: []error{
+				fmt.Errorf("--some-flag value build01 was not in cluster=priority format"),
+				fmt.Errorf("--some-flag sets the priority of build01 more than once"),
+				fmt.Errorf("--some-flag value build02=high does not have an integer priority"),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeClusterPriorities("some-flag", tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleteReferencePolicies(t *testing.T) {
+	tests := []struct {
+		name           string
+		raw            flagutil.Strings
+		expected       map[string]imagev1.TagReferencePolicyType
+		expectedErrors []error
+	}{
+		{
+			name:     "no flags",
+			expected: map[string]imagev1.TagReferencePolicyType{},
+		},
+		{
+			name:     "policies",
+			raw:      flagutil.NewStrings("build01=Source", "build02=Local"),
+			expected: map[string]imagev1.TagReferencePolicyType{"build01": imagev1.SourceTagReferencePolicy, "build02": imagev1.LocalTagReferencePolicy},
+		},
+		{
+			name:     "invalid and duplicate policies",
+			raw:      flagutil.NewStrings("build01", "build01=Source", "build01=Local", "build02=Remote"),
+			expected: map[string]imagev1.TagReferencePolicyType{"build01": imagev1.SourceTagReferencePolicy},
+			expectedErrors: []error{
+				fmt.Errorf("--some-flag value build01 was not in key=policy format"),
+				fmt.Errorf("--some-flag sets the reference policy of build01 more than once"),
+				fmt.Errorf("--some-flag value Remote is not a reference policy, must be one of Local or Source"),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualErrors := completeReferencePolicies("some-flag", tc.raw)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("actual does not match expected, diff: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedErrors, actualErrors, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("actualError does not match expectedError, diff: %s", diff)
+			}
+		})
+	}
+}
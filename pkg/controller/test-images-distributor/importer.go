@@ -0,0 +1,55 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	controllerutil "github.com/openshift/ci-tools/pkg/controller/util"
+)
+
+// Importer imports the images of an ImageStreamImport into a build cluster and
+// returns an error if the import didn't succeed
+type Importer interface {
+	Import(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error
+}
+
+// clientImporter creates the ImageStreamImport through the client of the build cluster
+type clientImporter struct {
+	// timeout is the time the build cluster gets to return the status of the import.
+	// Only the deadline of the passed context applies if unset.
+	timeout time.Duration
+}
+
+func (i clientImporter) Import(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error {
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+	// ImageStreamImport is not an ordinary api but a virtual one that does the import synchronously,
+	// the status is returned once the import is done
+	if err := client.Create(ctx, imageStreamImport); err != nil {
+		controllerutil.CountImportResult(ControllerName, cluster, imageStreamImport.Namespace, imageStreamImport.Name, false)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("imageStreamImport status not ready within deadline: %w", err)
+		}
+		return fmt.Errorf("failed to import Image: %w", err)
+	}
+
+	var tag string
+	if images := imageStreamImport.Spec.Images; len(images) > 0 && images[0].To != nil {
+		tag = images[0].To.Name
+	}
+	if err := imageStreamImportError(imageStreamImport.Status.Images, tag); err != nil {
+		return err
+	}
+
+	controllerutil.CountImportResult(ControllerName, cluster, imageStreamImport.Namespace, imageStreamImport.Name, true)
+	return nil
+}
@@ -0,0 +1,66 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+// managedStreamsRefreshInterval is how often the managed streams gauge gets refreshed
+const managedStreamsRefreshInterval = 5 * time.Minute
+
+// managedStreamsRefresher returns a runnable that sets the number of imagestreams the controller
+// manages on each build cluster every interval. As all manager.RunnableFuncs, it only runs on the leader.
+func managedStreamsRefresher(
+	interval time.Duration,
+	buildClusterClients map[string]ctrlruntimeclient.Client,
+	managedByAnnotation string,
+	gauge *prometheus.GaugeVec,
+) manager.RunnableFunc {
+	return func(ctx context.Context) error {
+		log := logrus.WithField("controller", ControllerName).WithField("subcomponent", "managed-streams-refresher")
+		for {
+			for cluster, client := range buildClusterClients {
+				if client == nil {
+					continue
+				}
+				count, err := countManagedImageStreams(ctx, client, managedByAnnotation)
+				if err != nil {
+					log.WithError(err).WithField("cluster", cluster).Error("Failed to count managed imagestreams")
+					continue
+				}
+				gauge.WithLabelValues(cluster).Set(float64(count))
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait.Jitter(interval, periodicResyncJitterFactor)):
+			}
+		}
+	}
+}
+
+// countManagedImageStreams returns the number of imagestreams that carry the managed-by annotation of the controller
+func countManagedImageStreams(ctx context.Context, client ctrlruntimeclient.Client, managedByAnnotation string) (int, error) {
+	imageStreams := &imagev1.ImageStreamList{}
+	if err := client.List(ctx, imageStreams); err != nil {
+		return 0, fmt.Errorf("failed to list imagestreams: %w", err)
+	}
+	var count int
+	for _, imageStream := range imageStreams.Items {
+		if imageStream.Annotations[managedByAnnotation] == ControllerName {
+			count++
+		}
+	}
+	return count, nil
+}
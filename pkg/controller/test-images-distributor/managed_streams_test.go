@@ -0,0 +1,108 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	dto "github.com/prometheus/client_model/go"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+func managedImageStreams(namespace string, managed, unmanaged int) []runtime.Object {
+	var result []runtime.Object
+	for i := 0; i < managed+unmanaged; i++ {
+		imageStream := &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: string(rune('a' + i))}}
+		if i < managed {
+			imageStream.Annotations = map[string]string{defaultManagedByAnnotation: ControllerName}
+		}
+		result = append(result, imageStream)
+	}
+	return result
+}
+
+func TestCountManagedImageStreams(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		client   ctrlruntimeclient.Client
+		expected int
+	}{
+		{
+			name:   "no imagestreams",
+			client: fakeclient.NewFakeClient(),
+		},
+		{
+			name:     "only managed imagestreams are counted",
+			client:   fakeclient.NewFakeClient(append(managedImageStreams("ci", 3, 2), managedImageStreams("other", 1, 0)...)...),
+			expected: 4,
+		},
+		{
+			name: "imagestreams managed by someone else are not counted",
+			client: fakeclient.NewFakeClient(&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ci",
+				Name:        "applyconfig",
+				Annotations: map[string]string{defaultManagedByAnnotation: "someone-else"},
+			}}),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := countManagedImageStreams(context.Background(), tc.client, defaultManagedByAnnotation)
+			if err != nil {
+				t.Fatalf("failed to count managed imagestreams: %v", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %d managed imagestreams, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestManagedStreamsRefresher(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gauge := newManagedStreamsGauge()
+	clients := map[string]ctrlruntimeclient.Client{
+		"build01": fakeclient.NewFakeClient(managedImageStreams("ci", 2, 1)...),
+		"build02": fakeclient.NewFakeClient(managedImageStreams("ci", 5, 0)...),
+		"build03": nil,
+	}
+	done := make(chan error)
+	go func() {
+		done <- managedStreamsRefresher(time.Hour, clients, defaultManagedByAnnotation, gauge).Start(ctx)
+	}()
+
+	expected := map[string]float64{"build01": 2, "build02": 5}
+	var actual map[string]float64
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		actual = map[string]float64{}
+		for cluster := range expected {
+			metric := &dto.Metric{}
+			if err := gauge.WithLabelValues(cluster).Write(metric); err != nil {
+				return false, err
+			}
+			actual[cluster] = metric.Gauge.GetValue()
+		}
+		return cmp.Equal(expected, actual), nil
+	}); err != nil {
+		t.Errorf("managed streams differ from expected: %s", cmp.Diff(expected, actual))
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("refresher returned error: %v", err)
+	}
+}
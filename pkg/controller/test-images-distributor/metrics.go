@@ -0,0 +1,87 @@
+package testimagesdistributor
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+const (
+	// skipReasonSameDigest means the imagestreamtag on the build cluster already points to the source image
+	skipReasonSameDigest = "same_digest"
+	// skipReasonUnmanaged means the imagestreamtag is not distributed to the build cluster
+	skipReasonUnmanaged = "unmanaged"
+	// skipReasonDenied means the source image lives in a forbidden registry
+	skipReasonDenied = "denied"
+	// skipReasonDeniedDigest means the source image has a denied digest
+	skipReasonDeniedDigest = "denied_digest"
+	// skipReasonClientUnavailable means there is no initialized client for the build cluster
+	skipReasonClientUnavailable = "client_unavailable"
+	// skipReasonPinned means the imagestreamtag on the build cluster is pinned to a digest
+	skipReasonPinned = "pinned"
+	// skipReasonSameRegistry means the build cluster uses the registry of the registry cluster
+	skipReasonSameRegistry = "same_registry"
+	// skipReasonDestinationNewer means the image on the build cluster is newer than the source image
+	skipReasonDestinationNewer = "destination_newer"
+	// skipReasonReleasePayload means the source imagestream is a release payload
+	skipReasonReleasePayload = "release_payload"
+)
+
+func newSkippedImportsCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ControllerName,
+		Name:      "imports_skipped_total",
+		Help:      "The number of imagestreamtag imports the controller skipped, by reason",
+	}, []string{"cluster", "reason"})
+}
+
+func (r *reconciler) countSkippedImport(cluster, reason string) {
+	if r.skippedImportsCounter == nil {
+		return
+	}
+	r.skippedImportsCounter.WithLabelValues(cluster, reason).Inc()
+}
+
+func newManagedStreamsGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ControllerName,
+		Name:      "managed_streams",
+		Help:      "The number of imagestreams managed by the controller, by build cluster",
+	}, []string{"cluster"})
+}
+
+func newImportDurationHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ControllerName,
+		Name:      "import_duration_seconds",
+		Help:      "The round-trip time of imagestreamimports into the build clusters, in seconds",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 10),
+	}, []string{"cluster"})
+}
+
+func (r *reconciler) observeImportDuration(cluster string, duration time.Duration) {
+	if r.importDurationHistogram == nil {
+		return
+	}
+	r.importDurationHistogram.WithLabelValues(cluster).Observe(duration.Seconds())
+}
+
+// newSourceImageAgeHistogram is not labelled by imagestream, as that would make the
+// number of series grow with every imagestream that ever got distributed
+func newSourceImageAgeHistogram() prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ControllerName,
+		Name:      "source_image_age_seconds",
+		Help:      "The age of the source images of the reconciled imagestreamtags, in seconds",
+		Buckets:   prometheus.ExponentialBuckets(60, 4, 10),
+	})
+}
+
+func (r *reconciler) observeSourceImageAge(image imagev1.Image) {
+	if r.sourceImageAgeHistogram == nil || image.CreationTimestamp.IsZero() {
+		return
+	}
+	r.sourceImageAgeHistogram.Observe(r.since(image.CreationTimestamp.Time).Seconds())
+}
@@ -0,0 +1,87 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+// periodicResyncJitterFactor spreads the resyncs of multiple replicas and restarts
+// so they do not all hit the apiservers at the same time
+const periodicResyncJitterFactor = 0.2
+
+// periodicResync returns a runnable that enqueues all imagestreamtags that pass the filter for all build
+// clusters every interval. It complements the watches, which may miss events, e.g. during apiserver restarts.
+// The reconciliation itself happens in the controller workers, so it is serialized with the watch events.
+func periodicResync(
+	interval time.Duration,
+	buildClusters sets.String,
+	registryClient ctrlruntimeclient.Client,
+	filter objectFilter,
+	events chan<- event.GenericEvent,
+) manager.RunnableFunc {
+	return func(ctx context.Context) error {
+		log := logrus.WithField("controller", ControllerName).WithField("subcomponent", "periodic-resync")
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait.Jitter(interval, periodicResyncJitterFactor)):
+			}
+
+			names, err := listFilteredImageStreamTags(ctx, registryClient, filter)
+			if err != nil {
+				log.WithError(err).Error("Failed to list imagestreamtags")
+				continue
+			}
+			log.WithField("imagestreamtags", len(names)).Info("Enqueuing periodic resync")
+			if err := enqueue(ctx, requestsForBuildClusters(buildClusters, names), events); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// requestsForBuildClusters returns the requests that reconcile the imagestreamtags for all build clusters
+func requestsForBuildClusters(buildClusters sets.String, names []types.NamespacedName) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, buildCluster := range buildClusters.List() {
+		for _, name := range names {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: buildCluster + clusterAndNamespaceDelimiter + name.Namespace,
+				Name:      name.Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// listFilteredImageStreamTags lists all imagestreamtags in the registry cluster that pass the filter
+func listFilteredImageStreamTags(ctx context.Context, registryClient ctrlruntimeclient.Client, filter objectFilter) ([]types.NamespacedName, error) {
+	imageStreams := &imagev1.ImageStreamList{}
+	if err := registryClient.List(ctx, imageStreams); err != nil {
+		return nil, fmt.Errorf("failed to list imagestreams: %w", err)
+	}
+	var result []types.NamespacedName
+	for _, imageStream := range imageStreams.Items {
+		for _, tag := range imageStream.Status.Tags {
+			name := types.NamespacedName{Namespace: imageStream.Namespace, Name: imageStream.Name + ":" + tag.Tag}
+			if filter(name) {
+				result = append(result, name)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+func periodicResyncTestImageStreams() []runtime.Object {
+	return []runtime.Object{
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}, {Tag: "previous"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "clonerefs"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "applyconfig"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}}},
+		},
+	}
+}
+
+func periodicResyncTestFilter(nn types.NamespacedName) bool {
+	return nn.Namespace == "ci" && nn.Name != "applyconfig:previous"
+}
+
+func TestListFilteredImageStreamTagsMatchesWatchHandler(t *testing.T) {
+	t.Parallel()
+	imageStreams := periodicResyncTestImageStreams()
+
+	listed, err := listFilteredImageStreamTags(context.Background(), fakeclient.NewFakeClient(imageStreams...), periodicResyncTestFilter)
+	if err != nil {
+		t.Fatalf("failed to list imagestreamtags: %v", err)
+	}
+	expected := []types.NamespacedName{
+		{Namespace: "ci", Name: "applyconfig:latest"},
+		{Namespace: "ci", Name: "clonerefs:latest"},
+	}
+	if diff := cmp.Diff(expected, listed); diff != "" {
+		t.Errorf("listed imagestreamtags differ from expected: %s", diff)
+	}
+
+	queue := &hijackingQueue{}
+	watchHandler := registryClusterHandlerFactory(sets.NewString("build01"), periodicResyncTestFilter)
+	for _, imageStream := range imageStreams {
+		watchHandler.Create(event.CreateEvent{Object: imageStream.(ctrlruntimeclient.Object)}, queue)
+	}
+	var watched []types.NamespacedName
+	for _, request := range queue.received {
+		_, name, err := decodeRequest(request)
+		if err != nil {
+			t.Fatalf("failed to decode request %s: %v", request, err)
+		}
+		watched = append(watched, name)
+	}
+	if diff := cmp.Diff(watched, listed); diff != "" {
+		t.Errorf("imagestreamtags from the watch handler differ from the listed ones: %s", diff)
+	}
+}
+
+func TestPeriodicResync(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan event.GenericEvent)
+	runnable := periodicResync(time.Millisecond, sets.NewString("build01", "build02"), fakeclient.NewFakeClient(periodicResyncTestImageStreams()...), periodicResyncTestFilter, events)
+	done := make(chan error)
+	go func() { done <- runnable.Start(ctx) }()
+
+	queue := &hijackingQueue{}
+	for i := 0; i < 4; i++ {
+		(&handler.EnqueueRequestForObject{}).Generic(<-events, queue)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("periodic resync returned error: %v", err)
+	}
+
+	expected := []reconcile.Request{
+		reconcileRequest("build01_ci", "applyconfig:latest"),
+		reconcileRequest("build01_ci", "clonerefs:latest"),
+		reconcileRequest("build02_ci", "applyconfig:latest"),
+		reconcileRequest("build02_ci", "clonerefs:latest"),
+	}
+	if diff := cmp.Diff(expected, queue.received); diff != "" {
+		t.Errorf("enqueued requests differ from expected: %s", diff)
+	}
+}
@@ -0,0 +1,134 @@
+package testimagesdistributor
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	testimagestreamtagimportv1 "github.com/openshift/ci-tools/pkg/api/testimagestreamtagimport/v1"
+)
+
+// resyncPath is the path on the metrics server under which the resync handler is served
+const resyncPath = "/" + ControllerName + "/resync"
+
+// resyncHandler returns a handler that enqueues a reconciliation for all build clusters of the
+// imagestreamtag passed in namespace/name:tag notation via the imagestreamtag query parameter.
+// Alternatively, all tags of the imagestream passed in namespace/name notation via the imagestream
+// query parameter are enqueued. Requests must carry the token returned by tokenGetter as bearer
+// token. The handler is served on every replica, but only the leader runs the controller, so
+// all other replicas answer with a 503 until elected gets closed.
+func resyncHandler(buildClusters sets.String, registryClient ctrlruntimeclient.Client, tokenGetter func() []byte, elected <-chan struct{}, events chan<- event.GenericEvent) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		token := bytes.TrimSpace(tokenGetter())
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if len(token) == 0 || subtle.ConstantTimeCompare([]byte(provided), token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		select {
+		case <-elected:
+		default:
+			http.Error(w, "this replica is not the leader", http.StatusServiceUnavailable)
+			return
+		}
+
+		var names []types.NamespacedName
+		var raw string
+		if stream := r.URL.Query().Get("imagestream"); stream != "" {
+			if r.URL.Query().Get("imagestreamtag") != "" {
+				http.Error(w, "only one of imagestream and imagestreamtag may be set", http.StatusBadRequest)
+				return
+			}
+			raw = stream
+			var status int
+			var err error
+			if names, status, err = imageStreamTagNames(r.Context(), registryClient, stream); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+		} else {
+			raw = r.URL.Query().Get("imagestreamtag")
+			name, err := parseImageStreamTagParam(raw)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			names = []types.NamespacedName{name}
+		}
+
+		if err := enqueue(r.Context(), requestsForBuildClusters(buildClusters, names), events); err != nil {
+			http.Error(w, "request got cancelled before it could be enqueued", http.StatusServiceUnavailable)
+			return
+		}
+		logrus.WithField("controller", ControllerName).WithField("target", raw).WithField("imagestreamtags", len(names)).Info("Enqueued forced resync")
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// parseImageStreamTagParam parses an imagestreamtag passed in namespace/name:tag notation
+func parseImageStreamTagParam(raw string) (types.NamespacedName, error) {
+	slashSplit := strings.Split(raw, "/")
+	if len(slashSplit) != 2 || slashSplit[0] == "" {
+		return types.NamespacedName{}, fmt.Errorf("imagestreamtag %q is not in namespace/name:tag format", raw)
+	}
+	if _, _, err := splitImageStreamTagName(slashSplit[1]); err != nil {
+		return types.NamespacedName{}, err
+	}
+	return types.NamespacedName{Namespace: slashSplit[0], Name: slashSplit[1]}, nil
+}
+
+// imageStreamTagNames returns the names of all tags of the imagestream passed in namespace/name
+// notation, along with the status code to answer with if that fails
+func imageStreamTagNames(ctx context.Context, registryClient ctrlruntimeclient.Client, raw string) ([]types.NamespacedName, int, error) {
+	slashSplit := strings.Split(raw, "/")
+	if len(slashSplit) != 2 || slashSplit[0] == "" || slashSplit[1] == "" || strings.Contains(slashSplit[1], ":") {
+		return nil, http.StatusBadRequest, fmt.Errorf("imagestream %q is not in namespace/name format", raw)
+	}
+	imageStream := &imagev1.ImageStream{}
+	if err := registryClient.Get(ctx, types.NamespacedName{Namespace: slashSplit[0], Name: slashSplit[1]}, imageStream); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, http.StatusNotFound, fmt.Errorf("imagestream %s not found", raw)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to get imagestream %s: %w", raw, err)
+	}
+	var names []types.NamespacedName
+	for _, tag := range imageStream.Status.Tags {
+		names = append(names, types.NamespacedName{Namespace: imageStream.Namespace, Name: imageStream.Name + ":" + tag.Tag})
+	}
+	return names, 0, nil
+}
+
+// enqueue sends the requests to the controller through the events channel
+func enqueue(ctx context.Context, requests []reconcile.Request, events chan<- event.GenericEvent) error {
+	for _, request := range requests {
+		obj := &testimagestreamtagimportv1.TestImageStreamTagImport{ObjectMeta: metav1.ObjectMeta{
+			Namespace: request.Namespace,
+			Name:      request.Name,
+		}}
+		select {
+		case events <- event.GenericEvent{Object: obj}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package testimagesdistributor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+func TestResyncHandler(t *testing.T) {
+	t.Parallel()
+	const token = "secret-token"
+	testCases := []struct {
+		name           string
+		method         string
+		token          string
+		imageStreamTag string
+		imageStream    string
+		notLeader      bool
+
+		expectedStatus   int
+		expectedBody     string
+		expectedRequests []reconcile.Request
+	}{
+		{
+			name:           "valid request is enqueued for all build clusters",
+			token:          token,
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusAccepted,
+			expectedRequests: []reconcile.Request{
+				reconcileRequest("build01_ci", "applyconfig:latest"),
+				reconcileRequest("build02_ci", "applyconfig:latest"),
+			},
+		},
+		{
+			name:           "malformed tag name is rejected",
+			token:          token,
+			imageStreamTag: "ci/applyconfig:latest:again",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing namespace is rejected",
+			token:          token,
+			imageStreamTag: "applyconfig:latest",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong token is rejected",
+			token:          "not-the-token",
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "all tags of the imagestream are enqueued for all build clusters",
+			token:          token,
+			imageStream:    "ci/applyconfig",
+			expectedStatus: http.StatusAccepted,
+			expectedRequests: []reconcile.Request{
+				reconcileRequest("build01_ci", "applyconfig:latest"),
+				reconcileRequest("build01_ci", "applyconfig:previous"),
+				reconcileRequest("build02_ci", "applyconfig:latest"),
+				reconcileRequest("build02_ci", "applyconfig:previous"),
+			},
+		},
+		{
+			name:           "missing imagestream is reported",
+			token:          token,
+			imageStream:    "ci/missing",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "imagestream ci/missing not found\n",
+		},
+		{
+			name:           "non-leader replica does not enqueue",
+			token:          token,
+			notLeader:      true,
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "imagestream with a tag is rejected",
+			token:          token,
+			imageStream:    "ci/applyconfig:latest",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "imagestream and imagestreamtag are rejected",
+			token:          token,
+			imageStream:    "ci/applyconfig",
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "GET is rejected",
+			method:         http.MethodGet,
+			token:          token,
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if tc.method == "" {
+				tc.method = http.MethodPost
+			}
+			buildClusters := sets.NewString("build01", "build02")
+			events := make(chan event.GenericEvent, 2*buildClusters.Len())
+			registryClient := fakeclient.NewFakeClient(&imagev1.ImageStream{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig"},
+				Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}, {Tag: "previous"}}},
+			})
+			elected := make(chan struct{})
+			if !tc.notLeader {
+				close(elected)
+			}
+			h := resyncHandler(buildClusters, registryClient, func() []byte { return []byte(token + "\n") }, elected, events)
+
+			query := url.Values{}
+			if tc.imageStreamTag != "" {
+				query.Set("imagestreamtag", tc.imageStreamTag)
+			}
+			if tc.imageStream != "" {
+				query.Set("imagestream", tc.imageStream)
+			}
+			req := httptest.NewRequest(tc.method, resyncPath+"?"+query.Encode(), nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			close(events)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d (body: %s)", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("expected body %q, got %q", tc.expectedBody, rr.Body.String())
+			}
+			queue := &hijackingQueue{}
+			for e := range events {
+				(&handler.EnqueueRequestForObject{}).Generic(e, queue)
+			}
+			if diff := cmp.Diff(tc.expectedRequests, queue.received); diff != "" {
+				t.Errorf("enqueued requests differ from expected: %s", diff)
+			}
+		})
+	}
+}
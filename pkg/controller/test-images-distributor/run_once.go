@@ -0,0 +1,287 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	testimagestreamtagimportv1 "github.com/openshift/ci-tools/pkg/api/testimagestreamtagimport/v1"
+)
+
+// RunOnceSummary summarizes a single pass over all distributed imagestreamtags
+type RunOnceSummary struct {
+	// Reconciled is the number of imagestreamtag and build cluster pairs that got reconciled
+	Reconciled int
+	// Imported is the number of imports that were created
+	Imported int
+	// Failed is the number of reconciliations that returned an error
+	Failed int
+	// Deferred is the number of imagestreamtag and build cluster pairs that did not get
+	// reconciled because the cap of imports was reached or that have to be reconciled
+	// again later, e.g. because their image is younger than the minimum age. They need
+	// another run.
+	Deferred int
+}
+
+// RunOnce reconciles all imagestreamtags that match the params for all build clusters
+// once instead of running as a controller. It is meant for backfills and validation,
+// all errors are aggregated and returned after every pair got reconciled. The options
+// are the same as the ones of AddToManager.
+func RunOnce(
+	ctx context.Context,
+	registryClusterName string,
+	registryClient ctrlruntimeclient.Client,
+	buildClusterClients map[string]ctrlruntimeclient.Client,
+	ignoreClusterNames sets.String,
+	params FilterParams,
+	forbiddenRegistries sets.String,
+	opts Options,
+) (RunOnceSummary, error) {
+	names, err := ListMatchingTags(ctx, registryClient, params)
+	if err != nil {
+		return RunOnceSummary{}, err
+	}
+	log := logrus.WithField("controller", ControllerName).WithField("mode", "once")
+	r := newReconciler(log, registryClusterName, registryClient, distributionTargets(buildClusterClients, ignoreClusterNames), forbiddenRegistries, opts)
+	summary, _, err := r.runOnce(ctx, names)
+	return summary, err
+}
+
+// distributionTargets returns the clients of the build clusters that test images get
+// distributed to
+func distributionTargets(buildClusterClients map[string]ctrlruntimeclient.Client, ignoreClusterNames sets.String) map[string]ctrlruntimeclient.Client {
+	clients := map[string]ctrlruntimeclient.Client{}
+	for cluster, client := range buildClusterClients {
+		if cluster != disabledClusterName && !ignoreClusterNames.Has(cluster) {
+			clients[cluster] = client
+		}
+	}
+	return clients
+}
+
+// runOnce reconciles the given imagestreamtags for all build clusters of the reconciler,
+// one batch of clusters with the same priority after the other. The requests that got
+// deferred are returned, so callers that run next to the controller can requeue them.
+func (r *reconciler) runOnce(ctx context.Context, names []types.NamespacedName) (RunOnceSummary, []reconcile.Request, error) {
+	var summary RunOnceSummary
+	var deferred []reconcile.Request
+	var errs []error
+	budget := r.newImportBudget()
+	for _, batch := range r.clusterBatches() {
+		var requests []reconcile.Request
+		for _, cluster := range batch {
+			for _, name := range names {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: cluster + clusterAndNamespaceDelimiter + name.Namespace,
+					Name:      name.Name,
+				}})
+			}
+		}
+		results, err := r.reconcileAll(ctx, requests, budget)
+		for i, result := range results {
+			if result.deferred {
+				summary.Deferred++
+				deferred = append(deferred, requests[i])
+				continue
+			}
+			summary.Reconciled++
+			switch {
+			case result.err != nil:
+				summary.Failed++
+			case result.action == actionImported:
+				summary.Imported++
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if r.requirePriorityClusterSuccess {
+				errs = append(errs, fmt.Errorf("not reconciling clusters with a lower priority than %v because of failures", batch))
+				break
+			}
+		}
+	}
+	return summary, deferred, utilerrors.Flatten(utilerrors.NewAggregate(errs))
+}
+
+// clusterBatches groups the build clusters by their priority, highest priority first
+func (r *reconciler) clusterBatches() [][]string {
+	byPriority := map[int][]string{}
+	for _, cluster := range sets.StringKeySet(r.buildClusterClients).List() {
+		priority := r.clusterPriority[cluster]
+		byPriority[priority] = append(byPriority[priority], cluster)
+	}
+	var priorities []int
+	for priority := range byPriority {
+		priorities = append(priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	var batches [][]string
+	for _, priority := range priorities {
+		batches = append(batches, byPriority[priority])
+	}
+	return batches
+}
+
+// reconcileResult is the outcome of reconciling a single request
+type reconcileResult struct {
+	action action
+	err    error
+	// deferred is true if the request did not get reconciled because the
+	// import budget was exhausted or has to be reconciled again later
+	deferred bool
+}
+
+// importBudget caps the number of imports of a bulk reconciliation. A nil
+// budget is unlimited.
+type importBudget struct {
+	lock      sync.Mutex
+	remaining int
+}
+
+func (r *reconciler) newImportBudget() *importBudget {
+	if r.maxImportsPerRun < 1 {
+		return nil
+	}
+	return &importBudget{remaining: r.maxImportsPerRun}
+}
+
+func (b *importBudget) exhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.remaining < 1
+}
+
+func (b *importBudget) spend() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.remaining--
+}
+
+// reconcileAll reconciles all requests with at most bulkReconcileWorkers of them in
+// parallel and returns their results in the order of the requests, along with the
+// aggregated errors once all of them got reconciled. If the context gets cancelled,
+// the requests that did not get started are deferred and the results are returned
+// once the in-flight ones finished.
+func (r *reconciler) reconcileAll(ctx context.Context, requests []reconcile.Request, budget *importBudget) ([]reconcileResult, error) {
+	workers := r.bulkReconcileWorkers
+	if workers < 1 {
+		// Reconciliations of tags of the same imagestream conflict, see AddToManager
+		workers = 1
+	}
+	sem := semaphore.NewWeighted(int64(workers))
+	wg := sync.WaitGroup{}
+	// Every worker writes only its own index, so there is no need for locking
+	results := make([]reconcileResult, len(requests))
+	var errs []error
+	for i, request := range requests {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			for j := i; j < len(requests); j++ {
+				results[j] = reconcileResult{deferred: true}
+			}
+			errs = append(errs, fmt.Errorf("failed to acquire semaphore: %w", err))
+			break
+		}
+		// Whether a request imports is only known once it got reconciled, so with
+		// more than one worker, the in-flight ones may exceed the budget
+		if budget.exhausted() {
+			sem.Release(1)
+			results[i] = reconcileResult{deferred: true}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, request reconcile.Request) {
+			defer wg.Done()
+			defer sem.Release(1)
+			log := r.log.WithField("request", request.String())
+			action, err := r.reconcile(ctx, request, log)
+			var requeue requeueAfterError
+			if errors.As(err, &requeue) {
+				log.WithField("reason", requeue.reason).Debug("Deferring request")
+				results[i] = reconcileResult{action: action, deferred: true}
+				return
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to reconcile %s: %w", request, err)
+			}
+			if action == actionImported {
+				budget.spend()
+			}
+			results[i] = reconcileResult{action: action, err: err}
+		}(i, request)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+		}
+	}
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// importBatchingClient serves the lists of testimagestreamtagimports for a single
+// imagestreamtag from one list per imagestreamtag namespace, the filter would otherwise
+// send one request per imagestreamtag to the apiserver.
+type importBatchingClient struct {
+	ctrlruntimeclient.Client
+
+	lock        sync.Mutex
+	byNamespace map[string][]testimagestreamtagimportv1.TestImageStreamTagImport
+}
+
+func newImportBatchingClient(client ctrlruntimeclient.Client) ctrlruntimeclient.Client {
+	if client == nil {
+		return nil
+	}
+	return &importBatchingClient{Client: client, byNamespace: map[string][]testimagestreamtagimportv1.TestImageStreamTagImport{}}
+}
+
+func (c *importBatchingClient) List(ctx context.Context, list ctrlruntimeclient.ObjectList, opts ...ctrlruntimeclient.ListOption) error {
+	imports, isImportList := list.(*testimagestreamtagimportv1.TestImageStreamTagImportList)
+	listOpts := &ctrlruntimeclient.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if !isImportList || listOpts.Namespace != "" || listOpts.LabelSelector == nil {
+		return c.Client.List(ctx, list, opts...)
+	}
+	namespace, found := listOpts.LabelSelector.RequiresExactMatch(testimagestreamtagimportv1.LabelKeyImageStreamTagNamespace)
+	if !found {
+		return c.Client.List(ctx, list, opts...)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	items, listed := c.byNamespace[namespace]
+	if !listed {
+		namespaceImports := &testimagestreamtagimportv1.TestImageStreamTagImportList{}
+		if err := c.Client.List(ctx, namespaceImports, ctrlruntimeclient.MatchingLabels{testimagestreamtagimportv1.LabelKeyImageStreamTagNamespace: namespace}); err != nil {
+			return err
+		}
+		items = namespaceImports.Items
+		c.byNamespace[namespace] = items
+	}
+	imports.Items = nil
+	for _, item := range items {
+		if listOpts.LabelSelector.Matches(labels.Set(item.Labels)) {
+			imports.Items = append(imports.Items, *item.DeepCopy())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	"github.com/openshift/ci-tools/pkg/api"
+	"github.com/openshift/ci-tools/pkg/testhelper"
+)
+
+// streamFailingImporter fails all imports into the given imagestream
+type streamFailingImporter struct {
+	stream string
+}
+
+func (i streamFailingImporter) Import(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error {
+	if imageStreamImport.Name == i.stream {
+		return errors.New("registry is down")
+	}
+	return clientImporter{}.Import(ctx, cluster, client, imageStreamImport)
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: api.RegistryPullCredentialsSecret},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("abc")},
+	}
+	r := &reconciler{
+		log:                 logrus.NewEntry(logrus.StandardLogger()),
+		registryClusterName: "app.ci",
+		registryClient: fakeclient.NewFakeClient(
+			&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig"}},
+			&imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig:latest"},
+				Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}, DockerImageReference: "quay.io/openshift/ci@sha256:abc"},
+			},
+			&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "broken"}},
+			&imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "broken:latest"},
+				Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:def"}, DockerImageReference: "quay.io/openshift/ci@sha256:def"},
+			},
+			&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "young"}},
+			&imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "young:latest"},
+				Image: imagev1.Image{
+					ObjectMeta:           metav1.ObjectMeta{Name: "sha256:123", CreationTimestamp: metav1.NewTime(now)},
+					DockerImageReference: "quay.io/openshift/ci@sha256:123",
+				},
+			},
+		),
+		buildClusterClients: map[string]ctrlruntimeclient.Client{
+			"build01": bcc(fakeclient.NewFakeClient(pullSecret.DeepCopy())),
+			"build02": bcc(fakeclient.NewFakeClient(pullSecret.DeepCopy())),
+		},
+		importer:    streamFailingImporter{stream: "broken"},
+		minImageAge: time.Hour,
+		clock:       clocktesting.NewFakePassiveClock(now),
+	}
+
+	summary, deferred, err := r.runOnce(context.Background(), []types.NamespacedName{
+		{Namespace: "ci", Name: "applyconfig:latest"},
+		{Namespace: "ci", Name: "broken:latest"},
+		{Namespace: "ci", Name: "young:latest"},
+	})
+
+	expectedErr := errors.New("[failed to reconcile build01_ci/broken:latest: registry is down, failed to reconcile build02_ci/broken:latest: registry is down]")
+	if diff := cmp.Diff(expectedErr, err, testhelper.EquateErrorMessage); diff != "" {
+		t.Errorf("error differs from expected: %s", diff)
+	}
+	expected := RunOnceSummary{Reconciled: 4, Imported: 2, Failed: 2, Deferred: 2}
+	if diff := cmp.Diff(expected, summary); diff != "" {
+		t.Errorf("summary differs from expected: %s", diff)
+	}
+	expectedDeferred := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "build01_ci", Name: "young:latest"}},
+		{NamespacedName: types.NamespacedName{Namespace: "build02_ci", Name: "young:latest"}},
+	}
+	if diff := cmp.Diff(expectedDeferred, deferred); diff != "" {
+		t.Errorf("deferred requests differ from expected: %s", diff)
+	}
+}
+
+func TestReconcileAll(t *testing.T) {
+	t.Parallel()
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: api.RegistryPullCredentialsSecret},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("abc")},
+	}
+	var objects []runtime.Object
+	var requests []reconcile.Request
+	for _, stream := range []string{"applyconfig", "broken", "clonerefs", "initupload"} {
+		objects = append(objects,
+			&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: stream}},
+			&imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: stream + ":latest"},
+				Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}, DockerImageReference: "quay.io/openshift/ci@sha256:abc"},
+			},
+		)
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "build01_ci", Name: stream + ":latest"}})
+	}
+	// Requests that can not be decoded fail as well
+	requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ci", Name: "malformed:latest"}})
+	buildClusterClient := bcc(fakeclient.NewFakeClient(pullSecret))
+	r := &reconciler{
+		log:                  logrus.NewEntry(logrus.StandardLogger()),
+		registryClusterName:  "app.ci",
+		registryClient:       fakeclient.NewFakeClient(objects...),
+		buildClusterClients:  map[string]ctrlruntimeclient.Client{"build01": buildClusterClient},
+		importer:             streamFailingImporter{stream: "broken"},
+		bulkReconcileWorkers: 2,
+	}
+
+	_, err := r.reconcileAll(context.Background(), requests, nil)
+
+	expectedErr := errors.New("[failed to reconcile build01_ci/broken:latest: registry is down, failed to reconcile ci/malformed:latest: failed to decode request ci/malformed:latest: didn't get two but 1 segments when trying to extract cluster and namespace]")
+	if diff := cmp.Diff(expectedErr, err, testhelper.EquateErrorMessage); diff != "" {
+		t.Errorf("error differs from expected: %s", diff)
+	}
+	for _, stream := range []string{"applyconfig", "clonerefs", "initupload"} {
+		if err := buildClusterClient.Get(context.Background(), types.NamespacedName{Namespace: "ci", Name: stream}, &imagev1.ImageStreamImport{}); err != nil {
+			t.Errorf("expected import for %s to be created, got %v", stream, err)
+		}
+	}
+}
+
+// clusterRecordingImporter records the clusters it imported into, in order
+type clusterRecordingImporter struct {
+	lock     sync.Mutex
+	clusters []string
+	failFor  string
+}
+
+func (i *clusterRecordingImporter) Import(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error {
+	i.lock.Lock()
+	i.clusters = append(i.clusters, cluster)
+	i.lock.Unlock()
+	if cluster == i.failFor {
+		return errors.New("registry is down")
+	}
+	return clientImporter{}.Import(ctx, cluster, client, imageStreamImport)
+}
+
+func TestRunOnceOrdersClustersByPriority(t *testing.T) {
+	t.Parallel()
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: api.RegistryPullCredentialsSecret},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("abc")},
+	}
+	testCases := []struct {
+		name                          string
+		failFor                       string
+		requirePriorityClusterSuccess bool
+		expectedClusters              []string
+		expectedSummary               RunOnceSummary
+		expectedErr                   error
+	}{
+		{
+			name:             "clusters are imported into by priority",
+			expectedClusters: []string{"build03", "build01", "build04", "build02"},
+			expectedSummary:  RunOnceSummary{Reconciled: 4, Imported: 4},
+		},
+		{
+			name:             "failures of high priority clusters do not block the others by default",
+			failFor:          "build03",
+			expectedClusters: []string{"build03", "build01", "build04", "build02"},
+			expectedSummary:  RunOnceSummary{Reconciled: 4, Imported: 3, Failed: 1},
+			expectedErr:      errors.New("failed to reconcile build03_ci/applyconfig:latest: registry is down"),
+		},
+		{
+			name:                          "failures of high priority clusters block the others if required",
+			failFor:                       "build01",
+			requirePriorityClusterSuccess: true,
+			expectedClusters:              []string{"build03", "build01", "build04"},
+			expectedSummary:               RunOnceSummary{Reconciled: 3, Imported: 2, Failed: 1},
+			expectedErr:                   errors.New("[failed to reconcile build01_ci/applyconfig:latest: registry is down, not reconciling clusters with a lower priority than [build01 build04] because of failures]"),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			importer := &clusterRecordingImporter{failFor: tc.failFor}
+			buildClusterClients := map[string]ctrlruntimeclient.Client{}
+			for _, cluster := range []string{"build01", "build02", "build03", "build04"} {
+				buildClusterClients[cluster] = bcc(fakeclient.NewFakeClient(pullSecret.DeepCopy()))
+			}
+			r := &reconciler{
+				log:                 logrus.NewEntry(logrus.StandardLogger()),
+				registryClusterName: "app.ci",
+				registryClient: fakeclient.NewFakeClient(
+					&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig"}},
+					&imagev1.ImageStreamTag{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig:latest"},
+						Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}, DockerImageReference: "quay.io/openshift/ci@sha256:abc"},
+					},
+				),
+				buildClusterClients:           buildClusterClients,
+				importer:                      importer,
+				clusterPriority:               map[string]int{"build03": 10, "build01": 5, "build04": 5, "build02": -1},
+				requirePriorityClusterSuccess: tc.requirePriorityClusterSuccess,
+			}
+
+			summary, _, err := r.runOnce(context.Background(), []types.NamespacedName{{Namespace: "ci", Name: "applyconfig:latest"}})
+			if diff := cmp.Diff(tc.expectedErr, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("error differs from expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedSummary, summary); diff != "" {
+				t.Errorf("summary differs from expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedClusters, importer.clusters); diff != "" {
+				t.Errorf("order of imported clusters differs from expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestBulkReconciliationDefersImportsOverTheCap(t *testing.T) {
+	t.Parallel()
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: api.RegistryPullCredentialsSecret},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("abc")},
+	}
+	streams := []string{"applyconfig", "clonerefs", "entrypoint", "initupload", "sidecar"}
+	var objects []runtime.Object
+	for _, stream := range streams {
+		objects = append(objects,
+			&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: stream}},
+			&imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: stream + ":latest"},
+				Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}, DockerImageReference: "quay.io/openshift/ci@sha256:abc"},
+			},
+		)
+	}
+	buildClusterClient := bcc(fakeclient.NewFakeClient(pullSecret))
+	r := &reconciler{
+		log:                 logrus.NewEntry(logrus.StandardLogger()),
+		registryClusterName: "app.ci",
+		registryClient:      fakeclient.NewFakeClient(objects...),
+		buildClusterClients: map[string]ctrlruntimeclient.Client{"build01": buildClusterClient},
+		maxImportsPerRun:    2,
+	}
+	// The source of the first tag does not exist, so it does not use up the budget
+	names := []types.NamespacedName{{Namespace: "ci", Name: "missing:latest"}}
+	for _, stream := range streams {
+		names = append(names, types.NamespacedName{Namespace: "ci", Name: stream + ":latest"})
+	}
+
+	summary, deferred, err := r.runOnce(context.Background(), names)
+	if err != nil {
+		t.Fatalf("runOnce failed: %v", err)
+	}
+	expected := RunOnceSummary{Reconciled: 3, Imported: 2, Deferred: 3}
+	if diff := cmp.Diff(expected, summary); diff != "" {
+		t.Errorf("summary differs from expected: %s", diff)
+	}
+	var expectedDeferred []reconcile.Request
+	for _, stream := range streams[2:] {
+		expectedDeferred = append(expectedDeferred, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "build01_ci", Name: stream + ":latest"}})
+	}
+	if diff := cmp.Diff(expectedDeferred, deferred); diff != "" {
+		t.Errorf("deferred requests differ from expected: %s", diff)
+	}
+	for i, stream := range streams {
+		err := buildClusterClient.Get(context.Background(), types.NamespacedName{Namespace: "ci", Name: stream}, &imagev1.ImageStreamImport{})
+		if imported := err == nil; imported != (i < 2) {
+			t.Errorf("%s: expected import to exist: %t, got error %v", stream, i < 2, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+// copySignatures creates the signatures of the source image on the build cluster. Images are
+// content addressed, so the signatures are valid for the imported image as well. Signatures
+// that already exist are left alone, as signatures are immutable.
+func copySignatures(ctx context.Context, client ctrlruntimeclient.Client, image imagev1.Image) error {
+	for _, signature := range image.Signatures {
+		copied := &imagev1.ImageSignature{
+			ObjectMeta: metav1.ObjectMeta{Name: signature.Name},
+			Type:       signature.Type,
+			Content:    signature.Content,
+		}
+		if err := client.Create(ctx, copied); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create signature %s: %w", signature.Name, err)
+		}
+	}
+	return nil
+}
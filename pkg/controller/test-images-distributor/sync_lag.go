@@ -0,0 +1,108 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+// syncLagPath is the path on the metrics server under which the sync lag handler is served
+const syncLagPath = "/" + ControllerName + "/sync-lag"
+
+// clusterLag describes how far the tag on a build cluster is behind the registry cluster
+type clusterLag struct {
+	// UpToDate is true if the build cluster has the same image as the registry cluster
+	UpToDate bool `json:"upToDate,omitempty"`
+	// Missing is true if the tag doesn't exist on the build cluster
+	Missing bool `json:"missing,omitempty"`
+	// Lag is how much older the image on the build cluster is than the one on the
+	// registry cluster. It is zero if the tag is up to date or missing.
+	Lag time.Duration `json:"lag,omitempty"`
+}
+
+// syncLag returns for each build cluster how far its imagestreamtag is behind the one on the
+// registry cluster. The name must be in namespace/stream:tag notation and refers to the registry
+// cluster, the destination namespace and tag of every build cluster are looked up.
+func (r *reconciler) syncLag(ctx context.Context, name types.NamespacedName) (map[string]clusterLag, error) {
+	imageStreamName, tag, err := splitImageStreamTagName(name.Name)
+	if err != nil {
+		return nil, err
+	}
+	source, found, err := newestTagEvent(ctx, r.registryClient, types.NamespacedName{Namespace: name.Namespace, Name: imageStreamName}, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the newest image of %s from the registry cluster: %w", name.String(), err)
+	}
+	if !found {
+		return nil, fmt.Errorf("imagestreamtag %s doesn't exist on the registry cluster", name.String())
+	}
+
+	lags := map[string]clusterLag{}
+	for cluster, client := range r.buildClusterClients {
+		target, found, err := newestTagEvent(ctx, client, types.NamespacedName{Namespace: r.targetNamespace(cluster, name.Namespace), Name: imageStreamName}, r.targetTag(tag))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the newest image of %s from cluster %s: %w", name.String(), cluster, err)
+		}
+		switch {
+		case !found:
+			lags[cluster] = clusterLag{Missing: true}
+		case target.Image == source.Image:
+			lags[cluster] = clusterLag{UpToDate: true}
+		default:
+			lags[cluster] = clusterLag{Lag: source.Created.Sub(target.Created.Time)}
+		}
+	}
+	return lags, nil
+}
+
+// syncLagHandler returns a handler that serves the sync lag of the imagestreamtag passed in
+// namespace/name:tag notation via the imagestreamtag query parameter as JSON, keyed by build
+// cluster. The lag is in nanoseconds.
+func syncLagHandler(syncLag func(context.Context, types.NamespacedName) (map[string]clusterLag, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		name, err := parseImageStreamTagParam(r.URL.Query().Get("imagestreamtag"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lags, err := syncLag(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(lags); err != nil {
+			logrus.WithField("controller", ControllerName).WithError(err).Warn("Failed to write sync lag")
+		}
+	})
+}
+
+// newestTagEvent returns the newest event of the tag in the imagestream and whether there is one
+func newestTagEvent(ctx context.Context, client ctrlruntimeclient.Client, name types.NamespacedName, tag string) (imagev1.TagEvent, bool, error) {
+	imageStream := &imagev1.ImageStream{}
+	if err := client.Get(ctx, name, imageStream); err != nil {
+		if apierrors.IsNotFound(err) {
+			return imagev1.TagEvent{}, false, nil
+		}
+		return imagev1.TagEvent{}, false, err
+	}
+	for _, tagEvents := range imageStream.Status.Tags {
+		if tagEvents.Tag == tag && len(tagEvents.Items) > 0 {
+			return tagEvents.Items[0], true, nil
+		}
+	}
+	return imagev1.TagEvent{}, false, nil
+}
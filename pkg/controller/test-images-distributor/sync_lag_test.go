@@ -0,0 +1,173 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	imagev1 "github.com/openshift/api/image/v1"
+
+	"github.com/openshift/ci-tools/pkg/testhelper"
+)
+
+func imageStreamWithNewestImage(namespace, tag, image string, created time.Time) *imagev1.ImageStream {
+	return &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "applyconfig"},
+		Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{
+			Tag:   tag,
+			Items: []imagev1.TagEvent{{Image: image, Created: metav1.NewTime(created)}},
+		}}},
+	}
+}
+
+func TestSyncLag(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	name := types.NamespacedName{Namespace: "ci", Name: "applyconfig:latest"}
+	testCases := []struct {
+		name                 string
+		registryClient       ctrlruntimeclient.Client
+		buildClusterClients  map[string]ctrlruntimeclient.Client
+		destinationNamespace func(cluster, namespace string) string
+		destinationTag       func(string) string
+		expected             map[string]clusterLag
+		expectedError        error
+	}{
+		{
+			name:           "clusters at staggered timestamps",
+			registryClient: fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now.Add(time.Minute))),
+				"build02": fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:old", now.Add(-time.Hour))),
+				"build03": fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:older", now.Add(-24*time.Hour))),
+			},
+			expected: map[string]clusterLag{
+				"build01": {UpToDate: true},
+				"build02": {Lag: time.Hour},
+				"build03": {Lag: 24 * time.Hour},
+			},
+		},
+		{
+			name:           "destination namespace and tag are looked up",
+			registryClient: fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": fakeclient.NewFakeClient(
+					imageStreamWithNewestImage("ci", "latest", "sha256:old", now.Add(-time.Hour)),
+					imageStreamWithNewestImage("build01-ci", "stable", "sha256:new", now),
+				),
+			},
+			destinationNamespace: func(cluster, namespace string) string { return cluster + "-" + namespace },
+			destinationTag:       func(string) string { return "stable" },
+			expected: map[string]clusterLag{
+				"build01": {UpToDate: true},
+			},
+		},
+		{
+			name:           "tag is missing on a cluster",
+			registryClient: fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": fakeclient.NewFakeClient(),
+			},
+			expected: map[string]clusterLag{
+				"build01": {Missing: true},
+			},
+		},
+		{
+			name:           "tag is missing on the registry cluster",
+			registryClient: fakeclient.NewFakeClient(),
+			expectedError:  errors.New("imagestreamtag ci/applyconfig:latest doesn't exist on the registry cluster"),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := &reconciler{
+				registryClient:       tc.registryClient,
+				buildClusterClients:  tc.buildClusterClients,
+				destinationNamespace: tc.destinationNamespace,
+				destinationTag:       tc.destinationTag,
+			}
+			actual, err := r.syncLag(context.Background(), name)
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Fatalf("error differs from expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("lags differ from expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSyncLagHandler(t *testing.T) {
+	t.Parallel()
+	syncLag := func(_ context.Context, name types.NamespacedName) (map[string]clusterLag, error) {
+		if name.Namespace != "ci" {
+			return nil, errors.New("imagestreamtag doesn't exist on the registry cluster")
+		}
+		return map[string]clusterLag{"build01": {UpToDate: true}, "build02": {Lag: time.Second}, "build03": {Missing: true}}, nil
+	}
+	testCases := []struct {
+		name           string
+		method         string
+		imageStreamTag string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "lags are served as JSON",
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"build01":{"upToDate":true},"build02":{"lag":1000000000},"build03":{"missing":true}}` + "\n",
+		},
+		{
+			name:           "failure is reported",
+			imageStreamTag: "ocp/applyconfig:latest",
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "imagestreamtag doesn't exist on the registry cluster\n",
+		},
+		{
+			name:           "malformed imagestreamtag is rejected",
+			imageStreamTag: "applyconfig:latest",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "imagestreamtag \"applyconfig:latest\" is not in namespace/name:tag format\n",
+		},
+		{
+			name:           "POST is rejected",
+			method:         http.MethodPost,
+			imageStreamTag: "ci/applyconfig:latest",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "only GET is supported\n",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if tc.method == "" {
+				tc.method = http.MethodGet
+			}
+			query := url.Values{}
+			query.Set("imagestreamtag", tc.imageStreamTag)
+			rr := httptest.NewRecorder()
+			syncLagHandler(syncLag).ServeHTTP(rr, httptest.NewRequest(tc.method, syncLagPath+"?"+query.Encode(), nil))
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if diff := cmp.Diff(tc.expectedBody, rr.Body.String()); diff != "" {
+				t.Errorf("body differs from expected: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TagState is the image an imagestreamtag points to on a cluster
+type TagState struct {
+	Digest  string      `json:"digest"`
+	Created metav1.Time `json:"created"`
+}
+
+// SyncState holds the state of imagestreamtags across clusters. It is keyed by the
+// imagestreamtag in namespace/stream:tag notation and then by cluster name. Clusters
+// that don't have the imagestreamtag are omitted.
+type SyncState map[string]map[string]TagState
+
+// DumpState returns the state of all imagestreamtags that match the params on the
+// registry cluster and the build clusters they get distributed to. It can be serialized
+// to JSON to diff clusters offline. The options are the same as the ones of RunOnce, so
+// the imagestreamtags are looked up where the remaps of the options put them on the
+// build clusters.
+func DumpState(
+	ctx context.Context,
+	registryClusterName string,
+	registryClient ctrlruntimeclient.Client,
+	buildClusterClients map[string]ctrlruntimeclient.Client,
+	ignoreClusterNames sets.String,
+	params FilterParams,
+	opts Options,
+) (SyncState, error) {
+	names, err := ListMatchingTags(ctx, registryClient, params)
+	if err != nil {
+		return nil, err
+	}
+	log := logrus.WithField("controller", ControllerName).WithField("mode", "dump-state")
+	r := newReconciler(log, registryClusterName, registryClient, distributionTargets(buildClusterClients, ignoreClusterNames), nil, opts)
+	return r.dumpState(ctx, names)
+}
+
+// dumpState returns the state of the given imagestreamtags on the registry cluster and
+// all build clusters of the reconciler
+func (r *reconciler) dumpState(ctx context.Context, names []types.NamespacedName) (SyncState, error) {
+	state := SyncState{}
+	for _, name := range names {
+		imageStreamName, tag, err := splitImageStreamTagName(name.Name)
+		if err != nil {
+			return nil, err
+		}
+		clusters := map[string]TagState{}
+		event, found, err := newestTagEvent(ctx, r.registryClient, types.NamespacedName{Namespace: name.Namespace, Name: imageStreamName}, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the newest image of %s from the registry cluster: %w", name.String(), err)
+		}
+		if found {
+			clusters[r.registryClusterName] = TagState{Digest: event.Image, Created: event.Created}
+		}
+		for cluster, client := range r.buildClusterClients {
+			event, found, err := newestTagEvent(ctx, client, types.NamespacedName{Namespace: r.targetNamespace(cluster, name.Namespace), Name: imageStreamName}, r.targetTag(tag))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the newest image of %s from cluster %s: %w", name.String(), cluster, err)
+			}
+			if found {
+				clusters[cluster] = TagState{Digest: event.Image, Created: event.Created}
+			}
+		}
+		state[name.String()] = clusters
+	}
+	return state, nil
+}
@@ -0,0 +1,100 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDumpState(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	names := []types.NamespacedName{
+		{Namespace: "ci", Name: "applyconfig:latest"},
+		{Namespace: "ci", Name: "applyconfig:previous"},
+	}
+	testCases := []struct {
+		name                 string
+		buildClusterClients  map[string]ctrlruntimeclient.Client
+		destinationNamespace func(cluster, namespace string) string
+		destinationTag       func(string) string
+		expected             SyncState
+	}{
+		{
+			name: "clusters at staggered timestamps",
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now.Add(time.Minute))),
+				"build02": fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:old", now.Add(-time.Hour))),
+				"build03": fakeclient.NewFakeClient(),
+			},
+			expected: SyncState{
+				"ci/applyconfig:latest": {
+					"app.ci":  {Digest: "sha256:new", Created: metav1.NewTime(now)},
+					"build01": {Digest: "sha256:new", Created: metav1.NewTime(now.Add(time.Minute))},
+					"build02": {Digest: "sha256:old", Created: metav1.NewTime(now.Add(-time.Hour))},
+				},
+				"ci/applyconfig:previous": {},
+			},
+		},
+		{
+			name: "destination namespace and tag are looked up",
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": fakeclient.NewFakeClient(
+					imageStreamWithNewestImage("ci", "latest", "sha256:old", now.Add(-time.Hour)),
+					imageStreamWithNewestImage("build01-ci", "stable", "sha256:new", now),
+				),
+			},
+			destinationNamespace: func(cluster, namespace string) string { return cluster + "-" + namespace },
+			destinationTag:       func(string) string { return "stable" },
+			expected: SyncState{
+				"ci/applyconfig:latest": {
+					"app.ci":  {Digest: "sha256:new", Created: metav1.NewTime(now)},
+					"build01": {Digest: "sha256:new", Created: metav1.NewTime(now)},
+				},
+				"ci/applyconfig:previous": {
+					"build01": {Digest: "sha256:new", Created: metav1.NewTime(now)},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := &reconciler{
+				registryClusterName:  "app.ci",
+				registryClient:       fakeclient.NewFakeClient(imageStreamWithNewestImage("ci", "latest", "sha256:new", now)),
+				buildClusterClients:  tc.buildClusterClients,
+				destinationNamespace: tc.destinationNamespace,
+				destinationTag:       tc.destinationTag,
+			}
+			actual, err := r.dumpState(context.Background(), names)
+			if err != nil {
+				t.Fatalf("failed to dump state: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("state differs from expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestTagStateSerialization(t *testing.T) {
+	t.Parallel()
+	created := time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC)
+	serialized, err := json.Marshal(TagState{Digest: "sha256:old", Created: metav1.NewTime(created)})
+	if err != nil {
+		t.Fatalf("failed to serialize state: %v", err)
+	}
+	if expected := `{"digest":"sha256:old","created":"2021-06-01T11:00:00Z"}`; string(serialized) != expected {
+		t.Errorf("expected serialized state %s, got %s", expected, serialized)
+	}
+}
@@ -2,9 +2,16 @@ package testimagesdistributor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"path"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 
 	corev1 "k8s.io/api/core/v1"
@@ -13,15 +20,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	crcontrollerutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/openshift/api/image/docker10"
 	imagev1 "github.com/openshift/api/image/v1"
 
 	"github.com/openshift/ci-tools/pkg/api"
@@ -67,6 +78,188 @@ func isAmd64Cluster(cluster string) bool {
 	return true
 }
 
+// disabledClusterName is the cluster nothing is ever distributed to
+const disabledClusterName = "api.ci"
+
+// minBuildClusters is the number of build clusters the controller needs to distribute to.
+// Without any, it would silently do nothing.
+const minBuildClusters = 1
+
+// validateBuildClusters returns an error if less than minimum build clusters are left
+// to distribute to once the ignored ones are removed
+func validateBuildClusters(buildClusterManagers map[string]manager.Manager, ignoreClusterNames sets.String, minimum int) error {
+	clusters := sets.String{}
+	for name := range buildClusterManagers {
+		if name != disabledClusterName && !ignoreClusterNames.Has(name) {
+			clusters.Insert(name)
+		}
+	}
+	if clusters.Len() < minimum {
+		return fmt.Errorf("need at least %d build cluster(s) to distribute to, got %d: %v", minimum, clusters.Len(), clusters.List())
+	}
+	return nil
+}
+
+// Options are the optional behaviors of the distribution. The zero value distributes
+// all images as-is into the same namespace on every build cluster.
+type Options struct {
+	// DestinationNamespace maps the build cluster and the namespace of the source
+	// imagestreamtag to the namespace it gets imported into. Defaults to the identity.
+	DestinationNamespace func(cluster, namespace string) string
+	// Requester is the value of the requester annotation of the namespaces created on
+	// the build clusters. Defaults to the ControllerName.
+	Requester string
+	// PruneRemovedTags makes tags that got removed from their source imagestream get
+	// deleted on the build clusters
+	PruneRemovedTags bool
+	// ImportTimeout is the time the build clusters get to return the status of an
+	// import before it counts as failed. Unlimited if unset.
+	ImportTimeout time.Duration
+	// ScheduledImports makes the imported tags get periodically re-imported by the
+	// image import scheduler of the build clusters
+	ScheduledImports bool
+	// DisableLocalLookup stops the imagestreams on the build clusters from resolving
+	// references in pods to their tags
+	DisableLocalLookup bool
+	// CABundleSource is a configmap on the build clusters holding the CA bundle of the
+	// registry. It is copied into the target namespaces if set.
+	CABundleSource *types.NamespacedName
+	// DestinationTag maps the tag of the source imagestreamtag to the tag it gets
+	// imported as. Defaults to the identity.
+	DestinationTag func(string) string
+	// DeniedDigests returns the digests of images that must never be distributed. It
+	// is called on every reconciliation, so the returned set can change at runtime.
+	DeniedDigests func() sets.String
+	// PropagateSourceCommit makes the commit annotation of the source image get set on
+	// the imported tag
+	PropagateSourceCommit bool
+	// MinImageAge is the age images need to reach before they get imported. Younger
+	// images are requeued until they are old enough.
+	MinImageAge time.Duration
+	// DefaultReferencePolicy is the reference policy of the imported tags. Defaults to Local.
+	DefaultReferencePolicy imagev1.TagReferencePolicyType
+	// ReferencePolicies overrides the DefaultReferencePolicy per build cluster
+	ReferencePolicies map[string]imagev1.TagReferencePolicyType
+	// PropagateLookupPolicy makes the imagestreams on the build clusters use the lookup
+	// policy of their source imagestream rather than always resolving locally
+	PropagateLookupPolicy bool
+	// ManagedByAnnotation is the key of the annotation that marks the imagestreams on
+	// the build clusters as managed by this controller. Defaults to dptp.openshift.io/managed-by.
+	ManagedByAnnotation string
+	// CopySignatures makes the signatures of the source images get created on the build
+	// clusters after the import
+	CopySignatures bool
+	// BulkReconcileWorkers is the number of requests the one-shot mode reconciles in
+	// parallel. Defaults to one.
+	BulkReconcileWorkers int
+	// CompareContentDigest makes the images on the build clusters count as current if
+	// they have the same content digest annotation as the source image
+	CompareContentDigest bool
+	// DisableAnnotationCopying stops all annotations from getting copied from the source
+	// imagestream and strips the ones that got copied before from the build clusters
+	DisableAnnotationCopying bool
+	// PauseConfigMap is a configmap on the registry cluster. All distribution is paused
+	// while its paused key is set to true.
+	PauseConfigMap *types.NamespacedName
+	// CopyTagAnnotations makes the annotations of the source imagestreamtag that match the
+	// copied annotation prefixes get set on the imported tag
+	CopyTagAnnotations bool
+	// SkipNewerDestinations stops tags on the build clusters from getting replaced by the
+	// source image if their image was created after it, unless the source tag is forced
+	SkipNewerDestinations bool
+	// NamespaceReferencePolicies overrides the reference policy per namespace of the source
+	// imagestreamtag and takes precedence over ReferencePolicies
+	NamespaceReferencePolicies map[string]imagev1.TagReferencePolicyType
+	// ClusterPriority orders the build clusters in bulk reconciliations: clusters with a
+	// higher priority get reconciled first. Unlisted clusters have a priority of zero.
+	ClusterPriority map[string]int
+	// RequirePriorityClusterSuccess makes bulk reconciliations stop before clusters with a
+	// lower priority if reconciling the clusters with a higher priority failed
+	RequirePriorityClusterSuccess bool
+	// DestinationTTL makes every reconciliation stamp the destination imagestreams with
+	// an expiry that lies DestinationTTL in the future, so a pruner can remove the ones
+	// that stopped getting synced. Nothing is stamped if unset.
+	DestinationTTL time.Duration
+	// ReleasePayloadAnnotation is the key of the annotation that marks source imagestreams
+	// as release payloads, which are never distributed. Defaults to release.openshift.io/source.
+	ReleasePayloadAnnotation string
+	// PropagatedImageLabels are the keys of the labels of the source images that get set
+	// as annotations on the imported tags
+	PropagatedImageLabels []string
+	// MaxImportsPerRun caps the number of imports of a single one-shot run. The remaining
+	// requests are deferred. Unlimited if unset.
+	MaxImportsPerRun int
+	// NamespaceGlobs are path-style glob patterns, all imagestreams in namespaces
+	// matching any of them get distributed
+	NamespaceGlobs []string
+	// SkipNamespacePatterns exclude all imagestreams in matching namespaces, even if
+	// they would get distributed otherwise
+	SkipNamespacePatterns []*regexp.Regexp
+	// DenyByDefault makes only imagestreamtags that match the additional imagestreamtags,
+	// imagestreams, namespaces or NamespaceGlobs get distributed, see FilterParams
+	DenyByDefault bool
+	// ResyncTokenGetter returns the bearer token of the endpoint that forces resyncs. The
+	// endpoint is disabled if unset.
+	ResyncTokenGetter func() []byte
+	// PeriodicResyncInterval is the interval in which all imagestreamtags get enqueued,
+	// regardless of watch events. Disabled if unset.
+	PeriodicResyncInterval time.Duration
+	// MaxConcurrentReconciles is the number of controller workers. Defaults to one.
+	MaxConcurrentReconciles int
+	// CopiedAnnotationPrefixes are the prefixes of the annotations that get copied from
+	// the source imagestreams. Defaults to release.openshift.io/config.
+	CopiedAnnotationPrefixes []string
+}
+
+// newReconciler returns a reconciler that distributes the images according to the options
+func newReconciler(
+	log *logrus.Entry,
+	registryClusterName string,
+	registryClient ctrlruntimeclient.Client,
+	buildClusterClients map[string]ctrlruntimeclient.Client,
+	forbiddenRegistries sets.String,
+	opts Options,
+) *reconciler {
+	return &reconciler{
+		log:                           log,
+		registryClusterName:           registryClusterName,
+		registryClient:                registryClient,
+		buildClusterClients:           buildClusterClients,
+		forbiddenRegistries:           forbiddenRegistries,
+		destinationNamespace:          opts.DestinationNamespace,
+		requester:                     opts.Requester,
+		pruneRemovedTags:              opts.PruneRemovedTags,
+		importer:                      clientImporter{timeout: opts.ImportTimeout},
+		scheduledImports:              opts.ScheduledImports,
+		disableLocalLookup:            opts.DisableLocalLookup,
+		caBundleSource:                opts.CABundleSource,
+		destinationTag:                opts.DestinationTag,
+		deniedDigests:                 opts.DeniedDigests,
+		propagateSourceCommit:         opts.PropagateSourceCommit,
+		minImageAge:                   opts.MinImageAge,
+		defaultReferencePolicy:        opts.DefaultReferencePolicy,
+		referencePolicies:             opts.ReferencePolicies,
+		propagateLookupPolicy:         opts.PropagateLookupPolicy,
+		managedByAnnotation:           opts.ManagedByAnnotation,
+		copySignatures:                opts.CopySignatures,
+		bulkReconcileWorkers:          opts.BulkReconcileWorkers,
+		clock:                         clock.RealClock{},
+		compareContentDigest:          opts.CompareContentDigest,
+		disableAnnotationCopying:      opts.DisableAnnotationCopying,
+		pauseConfigMap:                opts.PauseConfigMap,
+		copyTagAnnotations:            opts.CopyTagAnnotations,
+		skipNewerDestinations:         opts.SkipNewerDestinations,
+		namespaceReferencePolicies:    opts.NamespaceReferencePolicies,
+		clusterPriority:               opts.ClusterPriority,
+		requirePriorityClusterSuccess: opts.RequirePriorityClusterSuccess,
+		destinationTTL:                opts.DestinationTTL,
+		releasePayloadAnnotation:      opts.ReleasePayloadAnnotation,
+		propagatedImageLabels:         opts.PropagatedImageLabels,
+		maxImportsPerRun:              opts.MaxImportsPerRun,
+		copiedAnnotationPrefixes:      opts.CopiedAnnotationPrefixes,
+	}
+}
+
 func AddToManager(mgr manager.Manager,
 	registryClusterName string,
 	registryManager manager.Manager,
@@ -78,23 +271,45 @@ func AddToManager(mgr manager.Manager,
 	additionalImageStreamNamespaces sets.String,
 	forbiddenRegistries sets.String,
 	ignoreClusterNames sets.String,
+	opts Options,
 ) error {
 	log := logrus.WithField("controller", ControllerName)
 
-	r := &reconciler{
-		log:                 log,
-		registryClusterName: registryClusterName,
-		registryClient:      imagestreamtagwrapper.MustNew(registryManager.GetClient(), registryManager.GetCache()),
-		buildClusterClients: map[string]ctrlruntimeclient.Client{},
-		forbiddenRegistries: forbiddenRegistries,
+	if err := validateBuildClusters(buildClusterManagers, ignoreClusterNames, minBuildClusters); err != nil {
+		return err
+	}
+
+	skippedImportsCounter := newSkippedImportsCounter()
+	if err := metrics.Registry.Register(skippedImportsCounter); err != nil {
+		return fmt.Errorf("failed to register skippedImportsCounter metric: %w", err)
+	}
+	sourceImageAgeHistogram := newSourceImageAgeHistogram()
+	if err := metrics.Registry.Register(sourceImageAgeHistogram); err != nil {
+		return fmt.Errorf("failed to register sourceImageAgeHistogram metric: %w", err)
 	}
+	importDurationHistogram := newImportDurationHistogram()
+	if err := metrics.Registry.Register(importDurationHistogram); err != nil {
+		return fmt.Errorf("failed to register importDurationHistogram metric: %w", err)
+	}
+	managedStreamsGauge := newManagedStreamsGauge()
+	if err := metrics.Registry.Register(managedStreamsGauge); err != nil {
+		return fmt.Errorf("failed to register managedStreamsGauge metric: %w", err)
+	}
+
+	// The pause configmap is read uncached, so we do not have to watch all configmaps of the registry cluster
+	registryClient := imagestreamtagwrapper.MustNew(newUncachedConfigMapsClient(registryManager), registryManager.GetCache())
+	r := newReconciler(log, registryClusterName, registryClient, map[string]ctrlruntimeclient.Client{}, forbiddenRegistries, opts)
+	r.skippedImportsCounter = skippedImportsCounter
+	r.sourceImageAgeHistogram = sourceImageAgeHistogram
+	r.importDurationHistogram = importDurationHistogram
+	r.buildClusterReaders = map[string]ctrlruntimeclient.Reader{}
 	c, err := controller.New(ControllerName, mgr, controller.Options{
 		Reconciler: r,
 		// We conflict on ImageStream level which means multiple request for imagestreamtags
-		// of the same imagestream will conflict so stay at one worker in order to reduce the
-		// number of errors we see. If we hit performance issues, we will probably need cluster
-		// and/or imagestream level locking.
-		MaxConcurrentReconciles: 1,
+		// of the same imagestream will conflict, so the default is one worker in order to reduce
+		// the number of errors we see. Conflicting imports are requeued, so more workers can be
+		// used under heavy image churn.
+		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to construct controller: %w", err)
@@ -102,7 +317,7 @@ func AddToManager(mgr manager.Manager,
 
 	buildClusters := sets.String{}
 	for buildClusterName, buildClusterManager := range buildClusterManagers {
-		if buildClusterName == "api.ci" {
+		if buildClusterName == disabledClusterName {
 			log.Debug("distribution to api.ci is disabled")
 			continue
 		}
@@ -111,7 +326,8 @@ func AddToManager(mgr manager.Manager,
 			continue
 		}
 		buildClusters.Insert(buildClusterName)
-		r.buildClusterClients[buildClusterName] = imagestreamtagwrapper.MustNew(buildClusterManager.GetClient(), buildClusterManager.GetCache())
+		r.buildClusterClients[buildClusterName] = imagestreamtagwrapper.MustNew(newUncachedConfigMapsClient(buildClusterManager), buildClusterManager.GetCache())
+		r.buildClusterReaders[buildClusterName] = buildClusterManager.GetAPIReader()
 
 		if buildClusterName == string(api.ClusterAPPCI) {
 			// We have a distinct handler for testimagestreamtagimports in app.ci because those have .spec.cluster set, whereas
@@ -127,6 +343,24 @@ func AddToManager(mgr manager.Manager,
 		}
 	}
 
+	if opts.ResyncTokenGetter != nil {
+		resyncEvents := make(chan event.GenericEvent)
+		if err := c.Watch(&source.Channel{Source: resyncEvents}, &handler.EnqueueRequestForObject{}); err != nil {
+			return fmt.Errorf("failed to create watch for forced resyncs: %w", err)
+		}
+		if err := mgr.AddMetricsExtraHandler(resyncPath, resyncHandler(buildClusters, r.registryClient, opts.ResyncTokenGetter, mgr.Elected(), resyncEvents)); err != nil {
+			return fmt.Errorf("failed to add resync handler: %w", err)
+		}
+	}
+
+	if err := mgr.AddMetricsExtraHandler(syncLagPath, syncLagHandler(r.syncLag)); err != nil {
+		return fmt.Errorf("failed to add sync lag handler: %w", err)
+	}
+
+	if err := mgr.Add(managedStreamsRefresher(managedStreamsRefreshInterval, r.buildClusterClients, r.managedByAnnotationKey(), managedStreamsGauge)); err != nil {
+		return fmt.Errorf("failed to add managed streams refresher: %w", err)
+	}
+
 	// TODO: Watch buildCluster ImageStreams as well. For now we assume no one will tamper with them.
 	if err := c.Watch(
 		source.NewKindWithCache(&testimagestreamtagimportv1.TestImageStreamTagImport{}, mgr.GetCache()),
@@ -144,10 +378,11 @@ func AddToManager(mgr manager.Manager,
 		appCIClient = imagestreamtagwrapper.MustNew(mgr.GetClient(), mgr.GetCache())
 	}
 
-	objectFilter, err := testInputImageStreamTagFilterFactory(log, configAgent, appCIClient, resolver, additionalImageStreamTags, additionalImageStreams, additionalImageStreamNamespaces, r.buildClusterClients)
+	explainingFilter, err := testInputImageStreamTagExplainingFilterFactory(log, configAgent, appCIClient, resolver, additionalImageStreamTags, additionalImageStreams, additionalImageStreamNamespaces, opts.NamespaceGlobs, opts.SkipNamespacePatterns, opts.DenyByDefault, r.buildClusterClients)
 	if err != nil {
 		return fmt.Errorf("failed to get filter for ImageStreamTags: %w", err)
 	}
+	objectFilter := loggingObjectFilter(log, explainingFilter)
 	if err := c.Watch(
 		source.NewKindWithCache(&imagev1.ImageStream{}, registryManager.GetCache()),
 		registryClusterHandlerFactory(buildClusters, objectFilter),
@@ -155,6 +390,16 @@ func AddToManager(mgr manager.Manager,
 		return fmt.Errorf("failed to create watch for ImageStreams: %w", err)
 	}
 
+	if opts.PeriodicResyncInterval > 0 {
+		periodicResyncEvents := make(chan event.GenericEvent)
+		if err := c.Watch(&source.Channel{Source: periodicResyncEvents}, &handler.EnqueueRequestForObject{}); err != nil {
+			return fmt.Errorf("failed to create watch for periodic resyncs: %w", err)
+		}
+		if err := mgr.Add(periodicResync(opts.PeriodicResyncInterval, buildClusters, r.registryClient, objectFilter, periodicResyncEvents)); err != nil {
+			return fmt.Errorf("failed to add periodic resync: %w", err)
+		}
+	}
+
 	configChangeChannel, err := configAgent.SubscribeToIndexChanges(indexName)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to index changes for index %s: %w", indexName, err)
@@ -286,6 +531,24 @@ func registryClusterHandlerFactory(buildClusters sets.String, filter objectFilte
 
 const clusterAndNamespaceDelimiter = "_"
 
+// validateRequest makes sure the request has a namespace and a name in stream:tag format
+func validateRequest(req reconcile.Request) error {
+	if req.Namespace == "" {
+		return errors.New("namespace is empty")
+	}
+	if req.Name == "" {
+		return errors.New("name is empty")
+	}
+	stream, tag, err := splitImageStreamTagName(req.Name)
+	if err != nil {
+		return err
+	}
+	if stream == "" || tag == "" {
+		return fmt.Errorf("imagestreamtag name %q is not in stream:tag format: stream and tag must not be empty", req.Name)
+	}
+	return nil
+}
+
 func decodeRequest(req reconcile.Request) (string, types.NamespacedName, error) {
 	clusterAndNamespace := strings.Split(req.Namespace, "_")
 	if n := len(clusterAndNamespace); n != 2 {
@@ -299,12 +562,174 @@ type reconciler struct {
 	registryClusterName string
 	registryClient      ctrlruntimeclient.Client
 	buildClusterClients map[string]ctrlruntimeclient.Client
+	// buildClusterReaders read from the apiservers of the build clusters rather than
+	// the caches, for objects we just wrote. The client of the cluster is used if unset.
+	buildClusterReaders map[string]ctrlruntimeclient.Reader
 	forbiddenRegistries sets.String
+	// destinationNamespace maps the build cluster and the namespace of the source imagestreamtag
+	// to the namespace it gets imported into on that cluster. Defaults to the identity if unset.
+	destinationNamespace func(cluster, namespace string) string
+	// defaultReferencePolicy is the reference policy of the imported tags. Defaults to
+	// Local if unset.
+	defaultReferencePolicy imagev1.TagReferencePolicyType
+	// referencePolicies overrides the defaultReferencePolicy per build cluster
+	referencePolicies map[string]imagev1.TagReferencePolicyType
+	// namespaceReferencePolicies overrides the reference policy per namespace of the source
+	// imagestreamtag and takes precedence over referencePolicies
+	namespaceReferencePolicies map[string]imagev1.TagReferencePolicyType
+	// minImageAge is the age images need to reach before they get imported. Younger
+	// images are requeued until they are old enough.
+	minImageAge time.Duration
+	// pruneRemovedTags makes tags that got removed from their source imagestream get
+	// deleted on the build clusters
+	pruneRemovedTags bool
+	// destinationTag maps the tag of the source imagestreamtag to the tag it gets imported
+	// as on the build cluster. Defaults to the identity if unset.
+	destinationTag func(string) string
+	// requester is the value of the requester annotation on the namespaces we create
+	// on the build clusters. Defaults to the ControllerName if unset.
+	requester string
+	// copiedAnnotationPrefixes are the prefixes of the annotations that are copied from
+	// the source imagestream. Defaults to defaultCopiedAnnotationPrefixes if empty.
+	copiedAnnotationPrefixes []string
+	// disableAnnotationCopying stops all annotations from getting copied from the source
+	// imagestream and strips the ones that got copied before from the build clusters
+	disableAnnotationCopying bool
+	// copyTagAnnotations makes the annotations of the source imagestreamtag that match the
+	// copied annotation prefixes get set on the imported tag
+	copyTagAnnotations bool
+	// propagateSourceCommit makes the commit annotation of the source image get
+	// set on the imported tag
+	propagateSourceCommit bool
+	// propagatedImageLabels are the keys of the labels of the source image that get set
+	// as annotations on the imported tag
+	propagatedImageLabels []string
+	// copySignatures makes the signatures of the source images get created on the build
+	// clusters after the import, so they can be used for policy enforcement there
+	copySignatures bool
+	// importer imports the images into the build clusters. Defaults to creating the
+	// ImageStreamImport through the client of the build cluster if unset.
+	importer Importer
+	// scheduledImports makes the imported tags get periodically re-imported by the
+	// image import scheduler of the build clusters
+	scheduledImports bool
+	// disableLocalLookup stops the imagestreams on the build clusters from resolving
+	// references in pods to their tags
+	disableLocalLookup bool
+	// managedByAnnotation is the key of the annotation that marks the imagestreams on the
+	// build clusters as managed by this controller. Defaults to defaultManagedByAnnotation.
+	managedByAnnotation string
+	// compareContentDigest makes the images on the build clusters count as current if
+	// they have the same contentDigestAnnotation as the source image, even if their
+	// digests differ. The digests are compared if either image lacks the annotation.
+	compareContentDigest bool
+	// skipNewerDestinations stops tags on the build clusters from getting replaced by the
+	// source image if their image was created after it, unless the source imagestreamtag
+	// has the forceSyncAnnotation
+	skipNewerDestinations bool
+	// destinationTTL makes every reconciliation stamp the destination imagestream with an
+	// expiresAtAnnotation that lies destinationTTL in the future, so a pruner can remove
+	// imagestreams that stopped getting synced. Nothing is stamped if unset.
+	destinationTTL time.Duration
+	// releasePayloadAnnotation is the key of the annotation that marks source imagestreams
+	// as release payloads, which are never distributed. Defaults to
+	// defaultReleasePayloadAnnotation if unset.
+	releasePayloadAnnotation string
+	// propagateLookupPolicy makes the imagestreams on the build clusters use the lookup
+	// policy of their source imagestream rather than always resolving locally. It is
+	// applied on every reconciliation, so changes to the source get propagated.
+	propagateLookupPolicy bool
+	// deniedDigests returns the digests of images that must never be distributed, e.g.
+	// because they are known to be vulnerable. It is called on every reconciliation,
+	// so the returned set can change at runtime.
+	deniedDigests func() sets.String
+	// pauseConfigMap is a configmap on the registry cluster. All distribution is paused
+	// while its pausedKey is set to true, e.g. during maintenance. It is read on every
+	// reconciliation, so pausing takes effect without a restart.
+	pauseConfigMap *types.NamespacedName
+	// caBundleSource is a configmap on the build clusters holding the CA bundle of the
+	// registry. It is copied into the target namespaces as caBundleConfigMapName if set.
+	caBundleSource *types.NamespacedName
+	// skippedImportsCounter counts the imports that were skipped, by reason. Nothing is
+	// counted if unset.
+	skippedImportsCounter *prometheus.CounterVec
+	// clock is used for all time-dependent decisions. Defaults to the real clock.
+	clock clock.PassiveClock
+	// bulkReconcileWorkers is the number of requests reconcileAll reconciles in parallel.
+	// Defaults to one.
+	bulkReconcileWorkers int
+	// maxImportsPerRun caps the number of imports of a single bulk reconciliation. Once
+	// it is reached, the remaining requests are deferred to be requeued. Unlimited if unset.
+	maxImportsPerRun int
+	// clusterPriority orders the build clusters when reconciling in bulk: clusters with a
+	// higher priority get reconciled before the ones with a lower priority. Unlisted
+	// clusters have a priority of zero.
+	clusterPriority map[string]int
+	// requirePriorityClusterSuccess makes bulk reconciliations stop before clusters with a
+	// lower priority if reconciling the clusters with a higher priority failed
+	requirePriorityClusterSuccess bool
+	// sourceImageAgeHistogram tracks the age of the source images, which
+	// surfaces source images that stopped getting updated. Nothing is tracked if unset.
+	sourceImageAgeHistogram prometheus.Histogram
+	// importDurationHistogram tracks the round-trip time of imports per build cluster.
+	// Nothing is tracked if unset.
+	importDurationHistogram *prometheus.HistogramVec
+}
+
+func (r *reconciler) targetNamespace(cluster, namespace string) string {
+	if r.destinationNamespace == nil {
+		return namespace
+	}
+	return r.destinationNamespace(cluster, namespace)
+}
+
+// now returns the current time according to the clock of the reconciler
+func (r *reconciler) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// since returns the time elapsed since t according to the clock of the reconciler
+func (r *reconciler) since(t time.Time) time.Duration {
+	if r.clock == nil {
+		return time.Since(t)
+	}
+	return r.clock.Since(t)
+}
+
+// referencePolicyFor resolves the reference policy for tags imported from the namespace into
+// the cluster: a namespace override wins over a cluster override, which wins over the default.
+func (r *reconciler) referencePolicyFor(cluster, namespace string) imagev1.TagReferencePolicyType {
+	if policy, ok := r.namespaceReferencePolicies[namespace]; ok {
+		return policy
+	}
+	if policy, ok := r.referencePolicies[cluster]; ok {
+		return policy
+	}
+	if r.defaultReferencePolicy != "" {
+		return r.defaultReferencePolicy
+	}
+	return imagev1.LocalTagReferencePolicy
+}
+
+func (r *reconciler) targetTag(tag string) string {
+	if r.destinationTag == nil {
+		return tag
+	}
+	return r.destinationTag(tag)
 }
 
 func (r *reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	log := r.log.WithField("request", req.String())
-	err := r.reconcile(ctx, req, log)
+	_, err := r.reconcile(ctx, req, log)
+	var requeue requeueAfterError
+	if errors.As(err, &requeue) {
+		log.WithField("requeue_after", requeue.after.String()).Info(requeue.reason)
+		return reconcile.Result{RequeueAfter: requeue.after}, nil
+	}
+	err = terminalIfPermanent(err)
 	if err != nil && !apierrors.IsConflict(err) {
 		log.WithError(err).Error("Reconciliation failed")
 	} else {
@@ -313,16 +738,74 @@ func (r *reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	return reconcile.Result{}, controllerutil.SwallowIfTerminal(err)
 }
 
-func (r *reconciler) reconcile(ctx context.Context, req reconcile.Request, log *logrus.Entry) error {
+// requeueAfterError makes the request get requeued after the given duration without
+// being treated as a failure
+type requeueAfterError struct {
+	reason string
+	after  time.Duration
+}
+
+func (e requeueAfterError) Error() string {
+	return fmt.Sprintf("%s, requeueing after %s", e.reason, e.after)
+}
+
+// unmaterializedImageRequeueInterval is how long to wait before retrying source images
+// whose docker image reference is not set yet, e.g. because their push did not complete
+const unmaterializedImageRequeueInterval = 30 * time.Second
+
+// conflictingImportRequeueInterval is how long to wait before retrying imports that
+// conflicted with a concurrent import into the same imagestream
+const conflictingImportRequeueInterval = 5 * time.Second
+
+// terminalIfPermanent marks errors from the apiserver that won't go away by retrying as terminal.
+// All other errors, e.g. server errors and timeouts, are retried.
+func terminalIfPermanent(err error) error {
+	if err == nil || controllerutil.IsTerminal(err) {
+		return err
+	}
+	if apierrors.IsBadRequest(err) || apierrors.IsInvalid(err) || apierrors.IsMethodNotSupported(err) || apierrors.IsRequestEntityTooLargeError(err) {
+		return controllerutil.TerminalError(err)
+	}
+	return err
+}
+
+// action is what a reconciliation did
+type action string
+
+const (
+	// actionImported means the imagestreamtag got imported into the build cluster
+	actionImported action = "imported"
+	// actionSkippedSameDigest means the imagestreamtag on the build cluster was already current
+	actionSkippedSameDigest action = "skipped_same_digest"
+	// actionDeleted means the imagestreamtag got deleted from the build cluster
+	actionDeleted action = "deleted"
+	// actionNoop means nothing was changed, e.g. because the imagestreamtag is not
+	// distributed to the build cluster or the reconciliation failed
+	actionNoop action = "noop"
+)
+
+func (r *reconciler) reconcile(ctx context.Context, req reconcile.Request, log *logrus.Entry) (action, error) {
+	if err := validateRequest(req); err != nil {
+		return actionNoop, controllerutil.TerminalError(fmt.Errorf("invalid request %s: %w", req, err))
+	}
 	cluster, decoded, err := decodeRequest(req)
 	if err != nil {
-		return fmt.Errorf("failed to decode request %s: %w", req, err)
+		return actionNoop, controllerutil.TerminalError(fmt.Errorf("failed to decode request %s: %w", req, err))
 	}
 
 	// Propagate the cluster, namespace and name fields back up
 	*log = *log.WithField("cluster", cluster).WithField("namespace", decoded.Namespace).WithField("name", decoded.Name)
 	log.Info("Starting reconciliation")
 
+	paused, err := r.isPaused(ctx)
+	if err != nil {
+		return actionNoop, err
+	}
+	if paused {
+		// Nothing watches the pause configmap, so requeue to pick the request up once distribution is resumed
+		return actionNoop, requeueAfterError{reason: "Distribution is paused", after: pausedRequeueInterval}
+	}
+
 	// One of the following is allowed:
 	// - multiarch namespaces to distribute on the proper non-amd64 clusters (ex.: ci-arm64 on arm01)
 	// or
@@ -330,90 +813,271 @@ func (r *reconciler) reconcile(ctx context.Context, req reconcile.Request, log *
 	if isMultiarchNamespace(decoded.Namespace) {
 		if !isNamespaceAllowedOnCluster(decoded.Namespace, cluster) {
 			log.Debug("multiarch imageStreamTag not allowed on cluster")
-			return nil
+			r.countSkippedImport(cluster, skipReasonUnmanaged)
+			return actionNoop, nil
 		}
 	} else if !isAmd64Cluster(cluster) {
 		log.Debug("imageStreamTag not allowed on non-amd64 cluster")
-		return nil
+		r.countSkippedImport(cluster, skipReasonUnmanaged)
+		return actionNoop, nil
 	}
 
 	// Fail asap if we cannot reconcile this
 	client, ok := r.buildClusterClients[cluster]
 	if !ok {
-		return controllerutil.TerminalError(fmt.Errorf("no client for cluster %q available", cluster))
+		return actionNoop, controllerutil.TerminalError(fmt.Errorf("no client for cluster %q available", cluster))
+	}
+	if client == nil {
+		log.Warn("Client for cluster is not initialized, skipping")
+		r.countSkippedImport(cluster, skipReasonClientUnavailable)
+		return actionNoop, nil
 	}
 
 	sourceImageStreamTag := &imagev1.ImageStreamTag{}
 	if err := r.registryClient.Get(ctx, decoded, sourceImageStreamTag); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Debug("Source imageStreamTag not found")
-			return nil
+			if !r.pruneRemovedTags {
+				return actionNoop, nil
+			}
+			return r.cleanupRemovedImageStreamTag(ctx, cluster, decoded, client, log)
 		}
-		return fmt.Errorf("failed to get imageStreamTag %s from registry cluster: %w", decoded.String(), err)
+		return actionNoop, fmt.Errorf("failed to get imageStreamTag %s from registry cluster: %w", decoded.String(), err)
+	}
+	if sourceImageStreamTag.Image.Name == "" {
+		// An import from it would be garbage, so retry until the object is complete
+		return actionNoop, fmt.Errorf("source image not fully populated for tag %s", decoded.String())
 	}
 
-	imageStreamNameAndTag := strings.Split(decoded.Name, ":")
-	if n := len(imageStreamNameAndTag); n != 2 {
-		return fmt.Errorf("when splitting imagestreamtagname %s by : expected two results, got %d", decoded.Name, n)
+	imageStreamName, imageTag, err := splitImageStreamTagName(decoded.Name)
+	if err != nil {
+		return actionNoop, controllerutil.TerminalError(err)
 	}
-	imageStreamName, imageTag := imageStreamNameAndTag[0], imageStreamNameAndTag[1]
+	r.observeSourceImageAge(sourceImageStreamTag.Image)
 	isName := types.NamespacedName{Namespace: decoded.Namespace, Name: imageStreamName}
 	sourceImageStream := &imagev1.ImageStream{}
 	if err := r.registryClient.Get(ctx, isName, sourceImageStream); err != nil {
-		return fmt.Errorf("failed to get imageStream %s from registry cluster: %w", isName.String(), err)
+		return actionNoop, fmt.Errorf("failed to get imageStream %s from registry cluster: %w", isName.String(), err)
+	}
+	if clusters, restricted := syncToClusters(sourceImageStream); restricted && !clusters.Has(cluster) {
+		log.WithField("sync_to", clusters.List()).Debug("ImageStream is not distributed to this cluster")
+		r.countSkippedImport(cluster, skipReasonUnmanaged)
+		return actionNoop, nil
+	}
+	if _, isReleasePayload := sourceImageStream.Annotations[r.releasePayloadAnnotationKey()]; isReleasePayload {
+		log.Debug("ImageStream is a release payload, skipping")
+		r.countSkippedImport(cluster, skipReasonReleasePayload)
+		return actionNoop, nil
 	}
 
 	registryDomain, err := api.RegistryDomainForClusterName(r.registryClusterName)
 	if err != nil {
-		return fmt.Errorf("failed to get registry domain for cluster %s: %w", r.registryClusterName, err)
+		return actionNoop, fmt.Errorf("failed to get registry domain for cluster %s: %w", r.registryClusterName, err)
+	}
+	if targetDomain, err := api.RegistryDomainForClusterName(cluster); err == nil && targetDomain == registryDomain {
+		log.WithField("registry", registryDomain).Warn("Build cluster uses the same registry as the registry cluster, refusing to import the image into the registry it came from")
+		r.countSkippedImport(cluster, skipReasonSameRegistry)
+		return actionNoop, nil
+	}
+	if sourceImageStreamTag.Image.DockerImageReference == "" {
+		// The forbidden registry check depends on the reference, so don't import until it is set
+		return actionNoop, requeueAfterError{reason: "Source image has no docker image reference yet", after: unmaterializedImageRequeueInterval}
 	}
 	pullSpec := pullSpecFromImageStreamTag(registryDomain, sourceImageStreamTag)
 	*log = *log.WithField("docker_image_reference", pullSpec)
 	if isImportForbidden(sourceImageStreamTag.Image.DockerImageReference, r.forbiddenRegistries) {
 		log.Debugf("Import from any cluster in %s is forbidden, ignoring", r.forbiddenRegistries)
-		return nil
+		r.countSkippedImport(cluster, skipReasonDenied)
+		return actionNoop, nil
+	}
+	if r.deniedDigests != nil && r.deniedDigests().Has(sourceImageStreamTag.Image.Name) {
+		log.WithField("digest", sourceImageStreamTag.Image.Name).Warn("Import of denied digest refused")
+		r.countSkippedImport(cluster, skipReasonDeniedDigest)
+		return actionNoop, nil
 	}
 
-	if err := client.Get(ctx, types.NamespacedName{Name: decoded.Namespace}, &corev1.Namespace{}); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("failed to check if namespace %s exists: %w", decoded.Namespace, err)
-		}
-		if err := client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: decoded.Namespace}}); err != nil && !apierrors.IsAlreadyExists(err) {
-			return fmt.Errorf("failed to create namespace %s: %w", decoded.Namespace, err)
+	if created := sourceImageStreamTag.Image.CreationTimestamp; r.minImageAge > 0 && !created.IsZero() {
+		if age := r.since(created.Time); age < r.minImageAge {
+			return actionNoop, requeueAfterError{reason: "Image is younger than the minimum age", after: r.minImageAge - age}
 		}
 	}
 
-	if err := r.ensureCIOperatorRoleBinding(ctx, decoded.Namespace, client, log); err != nil {
-		return fmt.Errorf("failed to ensure rolebinding: %w", err)
+	targetNamespace := r.targetNamespace(cluster, decoded.Namespace)
+	if targetNamespace != decoded.Namespace {
+		*log = *log.WithField("target_namespace", targetNamespace)
+	}
+	targetTag := r.targetTag(imageTag)
+	if targetTag != imageTag {
+		*log = *log.WithField("target_tag", targetTag)
+	}
+	terminating, err := isNamespaceTerminating(ctx, targetNamespace, client)
+	if err != nil {
+		return actionNoop, err
+	}
+	if terminating {
+		log.Debug("Target namespace is terminating, skipping")
+		return actionNoop, nil
+	}
+	if err := r.ensureNamespace(ctx, targetNamespace, client, log); err != nil {
+		return actionNoop, err
+	}
+
+	if err := r.ensureCIOperatorRoleBinding(ctx, targetNamespace, client, log); err != nil {
+		return actionNoop, fmt.Errorf("failed to ensure rolebinding: %w", err)
 	}
-	if err := r.ensureCIOperatorRole(ctx, decoded.Namespace, client, log); err != nil {
-		return fmt.Errorf("failed to ensure role: %w", err)
+	if err := r.ensureCIOperatorRole(ctx, targetNamespace, client, log); err != nil {
+		return actionNoop, fmt.Errorf("failed to ensure role: %w", err)
 	}
-	if err := r.ensureImageStream(ctx, sourceImageStream, client, log); err != nil {
-		return fmt.Errorf("failed to ensure imagestream: %w", err)
+	referencePolicy := r.referencePolicyFor(cluster, decoded.Namespace)
+	if err := r.ensureImageStream(ctx, sourceImageStream, targetNamespace, referencePolicy, client, log); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return actionNoop, fmt.Errorf("failed to ensure imagestream: %w", err)
+		}
+		// Our cache is stale and the imagestream got created in the meantime. The import
+		// below lands in it regardless and the next reconciliation will update it.
+		log.Debug("Imagestream was created concurrently")
 	}
 
-	isCurrent, err := r.isImageStreamTagCurrent(ctx, decoded, client, sourceImageStreamTag)
+	targetName := types.NamespacedName{Namespace: targetNamespace, Name: imageStreamName + ":" + targetTag}
+	target, err := targetImageStreamTag(ctx, targetName, client)
 	if err != nil {
-		return fmt.Errorf("failed to check if imageStreamTag %s on cluster %s is current: %w", decoded.String(), cluster, err)
+		return actionNoop, fmt.Errorf("failed to check if imageStreamTag %s on cluster %s is current: %w", targetName.String(), cluster, err)
 	}
+	isCurrent := r.isImageStreamTagCurrent(target, sourceImageStreamTag)
 
+	targetISName := types.NamespacedName{Namespace: targetNamespace, Name: imageStreamName}
 	targetImageStream := &imagev1.ImageStream{}
-	if err := client.Get(ctx, isName, targetImageStream); err != nil {
+	targetImageStreamExists := true
+	if err := client.Get(ctx, targetISName, targetImageStream); err != nil {
 		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("failed to get imageStream %s from target cluster %s: %w", isName.String(), cluster, err)
+			return actionNoop, fmt.Errorf("failed to get imageStream %s from target cluster %s: %w", targetISName.String(), cluster, err)
 		}
+		targetImageStreamExists = false
 	}
+	// Refresh the expiry regardless of whether we import, the imagestream is still synced if its tags are current
+	if targetImageStreamExists {
+		if err := r.refreshExpiry(ctx, cluster, client, targetImageStream); err != nil {
+			return actionNoop, fmt.Errorf("failed to refresh expiry of imagestream %s: %w", targetISName.String(), err)
+		}
+	}
+	if pin, err := pinnedDigest(targetImageStream, targetTag); err != nil {
+		log.WithError(err).Warn("Ignoring invalid pin")
+	} else if pin != "" {
+		log.WithField("pinned_digest", pin).WithField("source_digest", sourceImageStreamTag.Image.Name).Info("ImageStreamTag is pinned, skipping")
+		r.countSkippedImport(cluster, skipReasonPinned)
+		return actionNoop, nil
+	}
+	tagAnnotations := r.tagAnnotations(sourceImageStreamTag, log)
 	if isCurrent {
 		log.WithField("isCurrent", isCurrent).Debug("ImageStreamTag is skipped")
-		return nil
+		r.countSkippedImport(cluster, skipReasonSameDigest)
+		// The annotations may have failed after the previous import or changed since
+		if !hasTagAnnotations(targetImageStream, targetTag, tagAnnotations) {
+			if err := annotateTag(ctx, r.readerFor(cluster, client), client, targetISName, targetTag, tagAnnotations); err != nil {
+				return actionSkippedSameDigest, fmt.Errorf("failed to annotate tag %s: %w", targetName.String(), err)
+			}
+		}
+		return actionSkippedSameDigest, nil
+	}
+	if r.skipNewerDestinations && !isForceSynced(sourceImageStreamTag) && isImageStreamTagNewer(target, sourceImageStreamTag) {
+		log.WithField("target_digest", target.Image.Name).Warn("ImageStreamTag on the build cluster is newer than the source, skipping")
+		r.countSkippedImport(cluster, skipReasonDestinationNewer)
+		return actionNoop, nil
 	}
-	if err := controllerutil.EnsureImagePullSecret(ctx, decoded.Namespace, client, log); err != nil {
-		return fmt.Errorf("failed to ensure imagePullSecret on cluster %s: %w", cluster, err)
+	if err := controllerutil.EnsureImagePullSecret(ctx, targetNamespace, client, log); err != nil {
+		return actionNoop, fmt.Errorf("failed to ensure imagePullSecret on cluster %s: %w", cluster, err)
+	}
+	if err := r.ensureCABundle(ctx, targetNamespace, client, log); err != nil {
+		return actionNoop, fmt.Errorf("failed to ensure CA bundle on cluster %s: %w", cluster, err)
+	}
+	imageStreamImport, err := buildImageStreamImport(cluster, sourceImageStreamTag, r.importOptions(registryDomain, referencePolicy))
+	if err != nil {
+		return actionNoop, controllerutil.TerminalError(fmt.Errorf("failed to build import: %w", err))
+	}
+
+	importer := r.importer
+	if importer == nil {
+		importer = clientImporter{}
+	}
+	importStart := r.now()
+	err = importer.Import(ctx, cluster, client, imageStreamImport)
+	r.observeImportDuration(cluster, r.since(importStart))
+	if err != nil {
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			// Someone else is importing into the same imagestream, check again once they are done
+			return actionNoop, requeueAfterError{reason: "Import conflicts with a concurrent one", after: conflictingImportRequeueInterval}
+		}
+		return actionNoop, err
+	}
+
+	log.Debug("Imported successfully")
+
+	// The cache does not have the tag the import just created yet
+	if err := annotateTag(ctx, r.readerFor(cluster, client), client, targetISName, targetTag, tagAnnotations); err != nil {
+		return actionImported, fmt.Errorf("failed to annotate tag %s: %w", targetName.String(), err)
+	}
+
+	if !targetImageStreamExists {
+		if err := r.refreshExpiry(ctx, cluster, client, &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: targetISName.Namespace, Name: targetISName.Name}}); err != nil {
+			return actionImported, fmt.Errorf("failed to set expiry of imagestream %s: %w", targetISName.String(), err)
+		}
 	}
-	imageStreamImport := &imagev1.ImageStreamImport{
+
+	if r.copySignatures {
+		if err := copySignatures(ctx, client, sourceImageStreamTag.Image); err != nil {
+			return actionImported, fmt.Errorf("failed to copy the signatures of %s: %w", pullSpec, err)
+		}
+	}
+
+	return actionImported, nil
+}
+
+// importOptions determine how buildImageStreamImport imports a source imagestreamtag
+type importOptions struct {
+	// registryDomain is the domain of the registry the source image gets pulled from
+	registryDomain string
+	// destinationNamespace maps the build cluster and the namespace of the source
+	// imagestreamtag to the namespace it gets imported into. Identity if unset.
+	destinationNamespace func(cluster, namespace string) string
+	// destinationTag maps the tag of the source imagestreamtag to the tag it gets
+	// imported as. Identity if unset.
+	destinationTag func(tag string) string
+	// referencePolicy is the reference policy of the imported tag
+	referencePolicy imagev1.TagReferencePolicyType
+	// scheduled makes the build cluster periodically re-import the tag
+	scheduled bool
+}
+
+func (r *reconciler) importOptions(registryDomain string, referencePolicy imagev1.TagReferencePolicyType) importOptions {
+	return importOptions{
+		registryDomain:       registryDomain,
+		destinationNamespace: r.destinationNamespace,
+		destinationTag:       r.destinationTag,
+		referencePolicy:      referencePolicy,
+		scheduled:            r.scheduledImports,
+	}
+}
+
+// buildImageStreamImport returns the import of the source imagestreamtag into the build cluster.
+// It has no side effects.
+func buildImageStreamImport(cluster string, source *imagev1.ImageStreamTag, opts importOptions) (*imagev1.ImageStreamImport, error) {
+	imageStreamName, tag, err := splitImageStreamTagName(source.Name)
+	if err != nil {
+		return nil, err
+	}
+	if source.Image.Name == "" {
+		return nil, fmt.Errorf("source image not fully populated for tag %s/%s", source.Namespace, source.Name)
+	}
+	namespace := source.Namespace
+	if opts.destinationNamespace != nil {
+		namespace = opts.destinationNamespace(cluster, namespace)
+	}
+	if opts.destinationTag != nil {
+		tag = opts.destinationTag(tag)
+	}
+	return &imagev1.ImageStreamImport{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: decoded.Namespace,
+			Namespace: namespace,
 			Name:      imageStreamName,
 		},
 		Spec: imagev1.ImageStreamImportSpec{
@@ -421,54 +1085,387 @@ func (r *reconciler) reconcile(ctx context.Context, req reconcile.Request, log *
 			Images: []imagev1.ImageImportSpec{{
 				From: corev1.ObjectReference{
 					Kind: "DockerImage",
-					Name: pullSpec,
+					Name: pullSpecFromImageStreamTag(opts.registryDomain, source),
 				},
-				To: &corev1.LocalObjectReference{Name: imageTag},
+				To: &corev1.LocalObjectReference{Name: tag},
 				ReferencePolicy: imagev1.TagReferencePolicy{
-					Type: imagev1.LocalTagReferencePolicy,
+					Type: opts.referencePolicy,
+				},
+				ImportPolicy: imagev1.TagImportPolicy{
+					Scheduled: opts.scheduled,
 				},
 			}},
 		},
+	}, nil
+}
+
+// imageStreamImportError returns an error listing all images that failed to import unless the
+// image for the tag got imported. Statuses without a tag are attributed to the tag.
+func imageStreamImportError(statuses []imagev1.ImageImportStatus, tag string) error {
+	// This should never happen, but we shouldn't panic if the server screws up
+	if len(statuses) == 0 {
+		return errors.New("imageStreamImport did not succeed: no image status was returned")
+	}
+	var failures []string
+	for _, status := range statuses {
+		if status.Image != nil {
+			if status.Tag == "" || status.Tag == tag {
+				return nil
+			}
+			continue
+		}
+		failure := fmt.Sprintf("reason: %s, message: %s", status.Status.Reason, status.Status.Message)
+		if status.Tag != "" {
+			failure = fmt.Sprintf("tag %s: %s", status.Tag, failure)
+		}
+		failures = append(failures, failure)
 	}
+	if len(failures) == 0 {
+		return fmt.Errorf("imageStreamImport did not succeed: no image status was returned for tag %s", tag)
+	}
+	return fmt.Errorf("imageStreamImport did not succeed: %s", strings.Join(failures, "; "))
+}
 
-	// ImageStreamImport is not an ordinary api but a virtual one that does the import synchronously
-	if err := client.Create(ctx, imageStreamImport); err != nil {
-		controllerutil.CountImportResult(ControllerName, cluster, decoded.Namespace, imageStreamName, false)
-		return fmt.Errorf("failed to import Image: %w", err)
+// cleanupRemovedImageStreamTag deletes the imageStreamTag from the build cluster if it got removed
+// from its source imageStream. If the source imageStream is gone altogether, nothing is done.
+func (r *reconciler) cleanupRemovedImageStreamTag(ctx context.Context, cluster string, name types.NamespacedName, client ctrlruntimeclient.Client, log *logrus.Entry) (action, error) {
+	imageStreamName, imageTag, err := splitImageStreamTagName(name.Name)
+	if err != nil {
+		log.WithError(err).Debug("Not cleaning up imageStreamTag with an invalid name")
+		return actionNoop, nil
+	}
+	isName := types.NamespacedName{Namespace: name.Namespace, Name: imageStreamName}
+	if err := r.registryClient.Get(ctx, isName, &imagev1.ImageStream{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Debug("Source imageStream not found")
+			return actionNoop, nil
+		}
+		return actionNoop, fmt.Errorf("failed to get imageStream %s from registry cluster: %w", isName.String(), err)
 	}
 
-	// This should never be needed, but we shouldn't panic if the server screws up
-	if imageStreamImport.Status.Images == nil {
-		imageStreamImport.Status.Images = []imagev1.ImageImportStatus{{}}
+	target := &imagev1.ImageStreamTag{ObjectMeta: metav1.ObjectMeta{Namespace: r.targetNamespace(cluster, name.Namespace), Name: imageStreamName + ":" + r.targetTag(imageTag)}}
+	if err := client.Delete(ctx, target); err != nil {
+		if apierrors.IsNotFound(err) {
+			return actionNoop, nil
+		}
+		return actionNoop, fmt.Errorf("failed to delete imageStreamTag %s/%s: %w", target.Namespace, target.Name, err)
 	}
-	if imageStreamImport.Status.Images[0].Image == nil {
-		return fmt.Errorf("imageStreamImport did not succeed: reason: %s, message: %s", imageStreamImport.Status.Images[0].Status.Reason, imageStreamImport.Status.Images[0].Status.Message)
+	log.Info("Deleted imageStreamTag that was removed from its source imageStream")
+	return actionDeleted, nil
+}
+
+// commitAnnotation holds the commit the image was built from
+const commitAnnotation = "io.openshift.build.commit.id"
+
+// annotateTag sets the annotations on the tag of the imagestream. It errors if the imagestream
+// has no such tag, e.g. because the import did not create it yet, so the request gets retried.
+func annotateTag(ctx context.Context, reader ctrlruntimeclient.Reader, client ctrlruntimeclient.Client, name types.NamespacedName, tag string, annotations map[string]string) error {
+	if len(annotations) == 0 {
+		return nil
 	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		imageStream := &imagev1.ImageStream{}
+		if err := reader.Get(ctx, name, imageStream); err != nil {
+			return fmt.Errorf("failed to get imagestream %s: %w", name.String(), err)
+		}
+		tagReference := findTagReference(imageStream, tag)
+		if tagReference == nil {
+			return fmt.Errorf("imagestream %s has no tag %s", name.String(), tag)
+		}
+		if hasAnnotations(tagReference.Annotations, annotations) {
+			return nil
+		}
+		if tagReference.Annotations == nil {
+			tagReference.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			tagReference.Annotations[key] = value
+		}
+		return client.Update(ctx, imageStream)
+	})
+}
 
-	controllerutil.CountImportResult(ControllerName, cluster, decoded.Namespace, imageStreamName, true)
+// hasTagAnnotations returns true if the tag of the imagestream has all annotations
+func hasTagAnnotations(imageStream *imagev1.ImageStream, tag string, annotations map[string]string) bool {
+	if len(annotations) == 0 {
+		return true
+	}
+	tagReference := findTagReference(imageStream, tag)
+	return tagReference != nil && hasAnnotations(tagReference.Annotations, annotations)
+}
 
-	log.Debug("Imported successfully")
+func findTagReference(imageStream *imagev1.ImageStream, tag string) *imagev1.TagReference {
+	for i := range imageStream.Spec.Tags {
+		if imageStream.Spec.Tags[i].Name == tag {
+			return &imageStream.Spec.Tags[i]
+		}
+	}
 	return nil
 }
 
-func (r *reconciler) isImageStreamTagCurrent(
-	ctx context.Context,
-	name types.NamespacedName,
-	targetClient ctrlruntimeclient.Client,
-	reference *imagev1.ImageStreamTag,
-) (bool, error) {
+// hasAnnotations returns true if all wanted annotations are set to their value
+func hasAnnotations(annotations, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if current, ok := annotations[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// tagAnnotations returns the annotations the imported tag gets according to the source
+func (r *reconciler) tagAnnotations(source *imagev1.ImageStreamTag, log *logrus.Entry) map[string]string {
+	annotations := map[string]string{}
+	if r.copyTagAnnotations {
+		prefixes := r.annotationPrefixes()
+		for key, value := range source.Annotations {
+			if hasAnyPrefix(key, prefixes) {
+				annotations[key] = value
+			}
+		}
+	}
+	if commit, ok := source.Image.Annotations[commitAnnotation]; ok && r.propagateSourceCommit {
+		annotations[commitAnnotation] = commit
+	}
+	if len(r.propagatedImageLabels) > 0 {
+		labels, err := imageLabels(source.Image)
+		if err != nil {
+			log.WithError(err).Warn("Failed to get the labels of the source image, not propagating them")
+		}
+		for _, key := range r.propagatedImageLabels {
+			if value, ok := labels[key]; ok {
+				annotations[key] = value
+			}
+		}
+	}
+	return annotations
+}
+
+// readerFor returns the reader that bypasses the cache of the cluster
+func (r *reconciler) readerFor(cluster string, client ctrlruntimeclient.Client) ctrlruntimeclient.Reader {
+	if reader, ok := r.buildClusterReaders[cluster]; ok {
+		return reader
+	}
+	return client
+}
+
+// imageLabels returns the labels from the docker metadata of the image. Images without
+// metadata have no labels.
+func imageLabels(image imagev1.Image) (map[string]string, error) {
+	if len(image.DockerImageMetadata.Raw) == 0 {
+		return nil, nil
+	}
+	metadata := &docker10.DockerImage{}
+	if err := json.Unmarshal(image.DockerImageMetadata.Raw, metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image.dockerImageMetadata: %w", err)
+	}
+	if metadata.Config == nil {
+		return nil, nil
+	}
+	return metadata.Config.Labels, nil
+}
+
+// refreshExpiry stamps the imagestream with an expiry that lies destinationTTL in the future.
+// To not update the imagestream on every reconciliation, it is only stamped once the expiry
+// in the passed, possibly cached, imagestream lies less than half the destinationTTL ahead.
+func (r *reconciler) refreshExpiry(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStream *imagev1.ImageStream) error {
+	if r.destinationTTL <= 0 {
+		return nil
+	}
+	now := r.now()
+	if expiresAt, err := time.Parse(time.RFC3339, imageStream.Annotations[expiresAtAnnotation]); err == nil && expiresAt.After(now.Add(r.destinationTTL/2)) {
+		return nil
+	}
+	expiresAt := now.Add(r.destinationTTL).UTC().Format(time.RFC3339)
+	name := types.NamespacedName{Namespace: imageStream.Namespace, Name: imageStream.Name}
+	return annotateImageStream(ctx, r.readerFor(cluster, client), client, name, map[string]string{expiresAtAnnotation: expiresAt})
+}
+
+// annotateImageStream sets the annotations on the imagestream. It is read through the reader,
+// as the cache may not have the imagestream yet if it just got created.
+func annotateImageStream(ctx context.Context, reader ctrlruntimeclient.Reader, client ctrlruntimeclient.Client, name types.NamespacedName, annotations map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		imageStream := &imagev1.ImageStream{}
+		if err := reader.Get(ctx, name, imageStream); err != nil {
+			return fmt.Errorf("failed to get imagestream %s: %w", name.String(), err)
+		}
+		if hasAnnotations(imageStream.Annotations, annotations) {
+			return nil
+		}
+		if imageStream.Annotations == nil {
+			imageStream.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			imageStream.Annotations[key] = value
+		}
+		return client.Update(ctx, imageStream)
+	})
+}
+
+// pinAnnotation on a tag of an imagestream on a build cluster freezes that tag. Its value must be
+// the sha256 digest the tag is pinned to.
+const pinAnnotation = "dptp.openshift.io/pin"
+
+// pinnedDigest returns the digest the tag is pinned to in the imagestream or an empty string if
+// it is not pinned
+func pinnedDigest(imageStream *imagev1.ImageStream, tag string) (string, error) {
+	for _, tagReference := range imageStream.Spec.Tags {
+		if tagReference.Name != tag {
+			continue
+		}
+		pin, pinned := tagReference.Annotations[pinAnnotation]
+		if !pinned {
+			return "", nil
+		}
+		if !isSHA256Digest(pin) {
+			return "", fmt.Errorf("%s annotation %q on tag %s is not a sha256 digest", pinAnnotation, pin, tag)
+		}
+		return pin, nil
+	}
+	return "", nil
+}
+
+func isSHA256Digest(s string) bool {
+	hex := strings.TrimPrefix(s, "sha256:")
+	if hex == s || len(hex) != 64 {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncToAnnotation restricts the build clusters an imagestream is distributed to. Its value
+// is a comma-separated list of cluster names.
+const syncToAnnotation = "dptp.openshift.io/sync-to"
+
+// syncToClusters returns the clusters the imagestream may be distributed to and whether
+// it is restricted at all
+func syncToClusters(imageStream *imagev1.ImageStream) (sets.String, bool) {
+	raw, set := imageStream.Annotations[syncToAnnotation]
+	if !set {
+		return nil, false
+	}
+	clusters := sets.NewString()
+	for _, cluster := range strings.Split(raw, ",") {
+		if cluster = strings.TrimSpace(cluster); cluster != "" {
+			clusters.Insert(cluster)
+		}
+	}
+	return clusters, true
+}
+
+func isNamespaceTerminating(ctx context.Context, name string, client ctrlruntimeclient.Client) (bool, error) {
+	namespace := &corev1.Namespace{}
+	if err := client.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check if namespace %s exists: %w", name, err)
+	}
+	return namespace.Status.Phase == corev1.NamespaceTerminating, nil
+}
+
+func (r *reconciler) ensureNamespace(ctx context.Context, name string, client ctrlruntimeclient.Client, log *logrus.Entry) error {
+	requester := r.requester
+	if requester == "" {
+		requester = ControllerName
+	}
+	namespace := &corev1.Namespace{}
+	if err := client.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to check if namespace %s exists: %w", name, err)
+		}
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{api.DPTPRequesterLabel: requester},
+		}}
+		err := client.Create(ctx, namespace)
+		if err == nil {
+			return nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create namespace %s: %w", name, err)
+		}
+		// Someone else created it in the meantime, make sure it gets the annotation as well
+		namespace = &corev1.Namespace{}
+		if err := client.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+			return fmt.Errorf("failed to get namespace %s after it was created concurrently: %w", name, err)
+		}
+	}
+
+	// Do not take over namespaces that were created by someone else
+	if _, set := namespace.Annotations[api.DPTPRequesterLabel]; set {
+		return nil
+	}
+	original := namespace.DeepCopy()
+	if namespace.Annotations == nil {
+		namespace.Annotations = map[string]string{}
+	}
+	namespace.Annotations[api.DPTPRequesterLabel] = requester
+	if err := client.Patch(ctx, namespace, ctrlruntimeclient.MergeFrom(original)); err != nil {
+		return fmt.Errorf("failed to add the requester annotation to namespace %s: %w", name, err)
+	}
+	log.WithField("target_namespace", name).Debug("Added requester annotation to namespace")
+	return nil
+}
 
+// targetImageStreamTag returns the imagestreamtag from the build cluster or nil if it doesn't exist
+func targetImageStreamTag(ctx context.Context, name types.NamespacedName, targetClient ctrlruntimeclient.Client) (*imagev1.ImageStreamTag, error) {
 	imageStreamTag := &imagev1.ImageStreamTag{}
 	if err := targetClient.Get(ctx, name, imageStreamTag); err != nil {
 		if apierrors.IsNotFound(err) {
-			return false, nil
+			return nil, nil
 		}
-		return false, fmt.Errorf("failed to get imagestreamtag %s: %w", name.String(), err)
+		return nil, fmt.Errorf("failed to get imagestreamtag %s: %w", name.String(), err)
 	}
+	return imageStreamTag, nil
+}
+
+func (r *reconciler) isImageStreamTagCurrent(target, reference *imagev1.ImageStreamTag) bool {
+	if target == nil {
+		return false
+	}
+	if r.compareContentDigest {
+		current, currentOK := target.Image.Annotations[contentDigestAnnotation]
+		source, sourceOK := reference.Image.Annotations[contentDigestAnnotation]
+		if currentOK && sourceOK {
+			return current == source
+		}
+	}
+	return target.Image.Name == reference.Image.Name
+}
+
+// isImageStreamTagNewer returns true if the image of the target was created after the one of
+// the reference. That should never happen, but importing would replace it with an older image,
+// e.g. if the clocks of the clusters are skewed.
+func isImageStreamTagNewer(target, reference *imagev1.ImageStreamTag) bool {
+	if target == nil || target.Image.CreationTimestamp.IsZero() || reference.Image.CreationTimestamp.IsZero() {
+		return false
+	}
+	return target.Image.CreationTimestamp.After(reference.Image.CreationTimestamp.Time)
+}
+
+// forceSyncAnnotation on a source imagestreamtag makes it get distributed even if the
+// tags on the build clusters are newer, e.g. to roll them back
+const forceSyncAnnotation = "dptp.openshift.io/force-sync"
 
-	return imageStreamTag.Image.Name == reference.Image.Name, nil
+func isForceSynced(imageStreamTag *imagev1.ImageStreamTag) bool {
+	return imageStreamTag.Annotations[forceSyncAnnotation] == "true"
 }
 
+// contentDigestAnnotation holds the digest of the content of an image. It stays the
+// same when the image gets pushed to a different registry, even if the digest of the
+// image changes.
+const contentDigestAnnotation = "dptp.openshift.io/content-digest"
+
+// expiresAtAnnotation on an imagestream on a build cluster holds the RFC3339 time after
+// which the imagestream may get pruned, unless it got synced again in the meantime
+const expiresAtAnnotation = "dptp.openshift.io/expires-at"
+
 const ciOperatorPullerRoleName = "ci-operator-image-puller"
 
 func ciOperatorRole(namespace string) (*rbacv1.Role, crcontrollerutil.MutateFn) {
@@ -495,6 +1492,56 @@ func (r *reconciler) ensureCIOperatorRole(ctx context.Context, namespace string,
 	return upsertObject(ctx, client, role, mutateFn, log)
 }
 
+// caBundleConfigMapName is the name of the configmap that holds the CA bundle of the registry
+// in the target namespaces
+const caBundleConfigMapName = "ca-bundle"
+
+// pausedKey is the key in the pauseConfigMap that pauses all distribution if set to true
+const pausedKey = "paused"
+
+// pausedRequeueInterval is how long to wait before retrying requests while distribution is paused
+const pausedRequeueInterval = 5 * time.Minute
+
+// isPaused returns true if distribution is paused through the pauseConfigMap
+func (r *reconciler) isPaused(ctx context.Context) (bool, error) {
+	if r.pauseConfigMap == nil {
+		return false, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := r.registryClient.Get(ctx, *r.pauseConfigMap, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get the pause configmap %s: %w", r.pauseConfigMap.String(), err)
+	}
+	return configMap.Data[pausedKey] == "true", nil
+}
+
+func (r *reconciler) ensureCABundle(ctx context.Context, namespace string, client ctrlruntimeclient.Client, log *logrus.Entry) error {
+	if r.caBundleSource == nil {
+		return nil
+	}
+	source := &corev1.ConfigMap{}
+	if err := client.Get(ctx, *r.caBundleSource, source); err != nil {
+		return fmt.Errorf("failed to get the source configmap %s: %w", r.caBundleSource.String(), err)
+	}
+	configMap, mutateFn := caBundle(source, namespace)
+	return upsertObject(ctx, client, configMap, mutateFn, log)
+}
+
+func caBundle(source *corev1.ConfigMap, namespace string) (*corev1.ConfigMap, crcontrollerutil.MutateFn) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      caBundleConfigMapName,
+		},
+	}
+	return configMap, func() error {
+		configMap.Data = source.Data
+		return nil
+	}
+}
+
 func ciOperatorRoleBinding(namespace string) (*rbacv1.RoleBinding, crcontrollerutil.MutateFn) {
 	rb := &rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
@@ -528,30 +1575,109 @@ func (r *reconciler) ensureCIOperatorRoleBinding(ctx context.Context, namespace
 // to copy the annotation if it exists
 const releaseConfigAnnotation = "release.openshift.io/config"
 
-func imagestream(imageStream *imagev1.ImageStream) (*imagev1.ImageStream, crcontrollerutil.MutateFn) {
+// defaultManagedByAnnotation is the annotation that marks the imagestreams on the build
+// clusters as managed by this controller, so they can be identified without knowing
+// which filters the controller uses
+const defaultManagedByAnnotation = "dptp.openshift.io/managed-by"
+
+// defaultCopiedAnnotationPrefixes are the prefixes of imagestream annotations that
+// get copied if no others are configured
+var defaultCopiedAnnotationPrefixes = []string{releaseConfigAnnotation}
+
+func imagestream(imageStream *imagev1.ImageStream, namespace string, copiedAnnotationPrefixes, managedAnnotationPrefixes []string, managedByAnnotation string, localLookup bool, referencePolicy imagev1.TagReferencePolicyType) (*imagev1.ImageStream, crcontrollerutil.MutateFn) {
 	stream := &imagev1.ImageStream{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: imageStream.Namespace,
+			Namespace: namespace,
 			Name:      imageStream.Name,
 		},
 	}
 	return stream, func() error {
-		if config, set := imageStream.Annotations[releaseConfigAnnotation]; set {
+		if len(copiedAnnotationPrefixes) == 0 {
+			// Nothing gets copied, so make sure nothing that got copied before survives.
+			// Annotations that are set by others are none of our business.
+			for key := range stream.Annotations {
+				if hasAnyPrefix(key, managedAnnotationPrefixes) {
+					delete(stream.Annotations, key)
+				}
+			}
+		}
+		for key, value := range imageStream.Annotations {
+			if !hasAnyPrefix(key, copiedAnnotationPrefixes) {
+				continue
+			}
 			if stream.Annotations == nil {
 				stream.Annotations = map[string]string{}
 			}
-			stream.Annotations[releaseConfigAnnotation] = config
+			stream.Annotations[key] = value
+		}
+		if stream.Annotations == nil {
+			stream.Annotations = map[string]string{}
 		}
-		stream.Spec.LookupPolicy.Local = true
+		stream.Annotations[managedByAnnotation] = ControllerName
+		stream.Spec.LookupPolicy.Local = localLookup
 		for i := range stream.Spec.Tags {
-			stream.Spec.Tags[i].ReferencePolicy.Type = imagev1.LocalTagReferencePolicy
+			stream.Spec.Tags[i].ReferencePolicy.Type = referencePolicy
 		}
 		return nil
 	}
 }
 
-func (r *reconciler) ensureImageStream(ctx context.Context, imageStream *imagev1.ImageStream, client ctrlruntimeclient.Client, log *logrus.Entry) error {
-	stream, mutateFn := imagestream(imageStream)
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// annotationPrefixes returns the prefixes of the annotations that get copied
+func (r *reconciler) annotationPrefixes() []string {
+	if r.disableAnnotationCopying {
+		return nil
+	}
+	if len(r.copiedAnnotationPrefixes) == 0 {
+		return defaultCopiedAnnotationPrefixes
+	}
+	return r.copiedAnnotationPrefixes
+}
+
+// managedAnnotationPrefixes returns the prefixes of the annotations that got copied
+// before, even if copying is disabled now
+func (r *reconciler) managedAnnotationPrefixes() []string {
+	if len(r.copiedAnnotationPrefixes) == 0 {
+		return defaultCopiedAnnotationPrefixes
+	}
+	return r.copiedAnnotationPrefixes
+}
+
+func (r *reconciler) managedByAnnotationKey() string {
+	if r.managedByAnnotation == "" {
+		return defaultManagedByAnnotation
+	}
+	return r.managedByAnnotation
+}
+
+// defaultReleasePayloadAnnotation is set by the release controller on the imagestreams it
+// assembles release payloads in. The release.openshift.io/config annotation is no marker
+// for payloads, as it is set on the imagestreams the payloads are assembled from as well,
+// which do get distributed.
+const defaultReleasePayloadAnnotation = "release.openshift.io/source"
+
+func (r *reconciler) releasePayloadAnnotationKey() string {
+	if r.releasePayloadAnnotation == "" {
+		return defaultReleasePayloadAnnotation
+	}
+	return r.releasePayloadAnnotation
+}
+
+func (r *reconciler) ensureImageStream(ctx context.Context, imageStream *imagev1.ImageStream, namespace string, referencePolicy imagev1.TagReferencePolicyType, client ctrlruntimeclient.Client, log *logrus.Entry) error {
+	copiedAnnotationPrefixes := r.annotationPrefixes()
+	localLookup := !r.disableLocalLookup
+	if r.propagateLookupPolicy {
+		localLookup = localLookup && imageStream.Spec.LookupPolicy.Local
+	}
+	stream, mutateFn := imagestream(imageStream, namespace, copiedAnnotationPrefixes, r.managedAnnotationPrefixes(), r.managedByAnnotationKey(), localLookup, referencePolicy)
 	return upsertObject(ctx, client, stream, mutateFn, log)
 }
 
@@ -569,46 +1695,103 @@ func testInputImageStreamTagFilterFactory(
 	additionalImageStreamTags,
 	additionalImageStreams,
 	additionalImageStreamNamespaces sets.String,
+	namespaceGlobs []string,
+	skipNamespacePatterns []*regexp.Regexp,
+	denyByDefault bool,
 	buildClusterClients map[string]ctrlruntimeclient.Client,
 ) (objectFilter, error) {
+	explain, err := testInputImageStreamTagExplainingFilterFactory(l, ca, client, resolver, additionalImageStreamTags, additionalImageStreams, additionalImageStreamNamespaces, namespaceGlobs, skipNamespacePatterns, denyByDefault, buildClusterClients)
+	if err != nil {
+		return nil, err
+	}
+	return func(nn types.NamespacedName) bool {
+		matches, _ := explain(nn)
+		return matches
+	}, nil
+}
+
+// loggingObjectFilter returns an objectFilter that logs the reason of the decision of the
+// explaining filter at debug level
+func loggingObjectFilter(log *logrus.Entry, filter explainingObjectFilter) objectFilter {
+	return func(nn types.NamespacedName) bool {
+		matches, reason := filter(nn)
+		if log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			log.WithField("name", nn.String()).WithField("distributed", matches).WithField("reason", reason).Debug("Filtered imagestreamtag")
+		}
+		return matches
+	}
+}
+
+// explainingObjectFilter is an objectFilter that additionally returns which rule decided
+// about the object, which is useful for debugging why something is (not) distributed
+type explainingObjectFilter func(types.NamespacedName) (bool, string)
+
+func testInputImageStreamTagExplainingFilterFactory(
+	l *logrus.Entry,
+	ca agents.ConfigAgent,
+	client ctrlruntimeclient.Client,
+	resolver registryResolver,
+	additionalImageStreamTags,
+	additionalImageStreams,
+	additionalImageStreamNamespaces sets.String,
+	namespaceGlobs []string,
+	skipNamespacePatterns []*regexp.Regexp,
+	denyByDefault bool,
+	buildClusterClients map[string]ctrlruntimeclient.Client,
+) (explainingObjectFilter, error) {
 	if err := ca.AddIndex(indexName, indexConfigsByTestInputImageStreamTag(resolver)); err != nil {
 		return nil, fmt.Errorf("failed to add %s index to configAgent: %w", indexName, err)
 	}
 	l = logrus.WithField("subcomponent", "test-input-image-stream-tag-filter")
 	buildClusterClients["app.ci"] = client
-	return func(nn types.NamespacedName) bool {
+	return func(nn types.NamespacedName) (bool, string) {
+		// Skipped namespaces take precedence over everything that would allow them
+		if namespaceMatchesAnyPattern(nn.Namespace, skipNamespacePatterns) {
+			return false, "denied by skipNamespacePatterns"
+		}
 		if additionalImageStreamTags.Has(nn.String()) {
-			return true
+			return true, "matched by additionalImageStreamTags"
 		}
 		if additionalImageStreamNamespaces.Has(nn.Namespace) {
-			return true
+			return true, "matched by additionalImageStreamNamespaces"
+		}
+		if namespaceMatchesAnyGlob(nn.Namespace, namespaceGlobs) {
+			return true, "matched by namespaceGlobs"
+		}
+		if denyByDefault {
+			// Only the explicit allow rules select imagestreamtags, references from
+			// configs and testimagestreamtagimports or multiarch namespaces do not
+			if imageStreamName, err := imageStreamNameFromImageStreamTagName(nn); err == nil && additionalImageStreams.Has(imageStreamName.String()) {
+				return true, "matched by additionalImageStreams"
+			}
+			return false, "not matched by any allow rule"
 		}
 		if isMultiarchNamespace(nn.Namespace) {
-			return true
+			return true, "matched by multiarch namespace"
 		}
 		imageStreamTagResult, err := ca.GetFromIndex(indexName, nn.String())
 		if err != nil {
 			l.WithField("name", nn.String()).WithError(err).Error("Failed to get imagestreamtag configs from index")
-			return false
+			return false, "failed to get imagestreamtag configs from index"
 		}
 		if len(imageStreamTagResult) > 0 {
-			return true
+			return true, "imagestreamtag is referenced by a ci-operator config"
 		}
 		imageStreamName, err := imageStreamNameFromImageStreamTagName(nn)
 		if err != nil {
 			l.WithField("name", nn.String()).WithError(err).Error("Failed to get imagestreamname for imagestreamtag")
-			return false
+			return false, "failed to get imagestreamname for imagestreamtag"
 		}
 		if additionalImageStreams.Has(imageStreamName.String()) {
-			return true
+			return true, "matched by additionalImageStreams"
 		}
 		imageStreamResult, err := ca.GetFromIndex(indexName, indexKeyForImageStream(imageStreamName.Namespace, imageStreamName.Name))
 		if err != nil {
 			l.WithField("name", imageStreamName.String()).WithError(err).Error("Failed to get imagestream configs from index")
-			return false
+			return false, "failed to get imagestream configs from index"
 		}
 		if len(imageStreamResult) > 0 {
-			return true
+			return true, "imagestream is referenced by a ci-operator config"
 		}
 
 		// We have to consider testimagestreamtagimports to cover the case of:
@@ -623,25 +1806,111 @@ func testInputImageStreamTagFilterFactory(
 		imports := &testimagestreamtagimportv1.TestImageStreamTagImportList{}
 		labels := ctrlruntimeclient.MatchingLabels(testimagestreamtagimportv1.LabelsForImageStreamTag(nn.Namespace, nn.Name))
 		for _, client := range buildClusterClients {
+			if client == nil {
+				continue
+			}
 			if err := client.List(context.TODO(), imports, labels); err != nil {
 				l.WithError(err).Error("Failed to list testimagestreamtagimport")
 				continue
 			}
 			if len(imports.Items) > 0 {
-				return true
+				return true, "imagestreamtag is referenced by a testimagestreamtagimport"
 			}
 		}
 
-		return false
+		return false, "imagestreamtag is not referenced"
 	}, nil
 }
 
+// FilterParams are the parameters that determine which imagestreamtags get distributed
+type FilterParams struct {
+	ConfigAgent                     agents.ConfigAgent
+	Resolver                        agents.RegistryAgent
+	AdditionalImageStreamTags       sets.String
+	AdditionalImageStreams          sets.String
+	AdditionalImageStreamNamespaces sets.String
+	// NamespaceGlobs are path-style glob patterns, all imagestreams in namespaces
+	// matching any of them get distributed
+	NamespaceGlobs []string
+	// SkipNamespacePatterns exclude all imagestreams in matching namespaces, even if
+	// they would get distributed otherwise
+	SkipNamespacePatterns []*regexp.Regexp
+	// DenyByDefault makes only imagestreamtags that match AdditionalImageStreamTags,
+	// AdditionalImageStreams, AdditionalImageStreamNamespaces or NamespaceGlobs get
+	// distributed, unless they match SkipNamespacePatterns. Imagestreamtags that are
+	// merely referenced by ci-operator configs or testimagestreamtagimports or that live
+	// in multiarch namespaces are not distributed.
+	DenyByDefault bool
+	// BuildClusterClients are used to find imagestreamtags that are referenced by
+	// testimagestreamtagimports
+	BuildClusterClients map[string]ctrlruntimeclient.Client
+}
+
+// ListMatchingTags lists the imagestreamtags in the registry cluster that get distributed
+// to the build clusters with the given parameters. The clients are not expected to be
+// cached, so the testimagestreamtagimports are listed once per namespace instead of
+// once per imagestreamtag.
+func ListMatchingTags(ctx context.Context, registryClient ctrlruntimeclient.Client, params FilterParams) ([]types.NamespacedName, error) {
+	buildClusterClients := map[string]ctrlruntimeclient.Client{}
+	for cluster, client := range params.BuildClusterClients {
+		buildClusterClients[cluster] = newImportBatchingClient(client)
+	}
+	filter, err := testInputImageStreamTagFilterFactory(
+		logrus.WithField("controller", ControllerName),
+		params.ConfigAgent,
+		newImportBatchingClient(registryClient),
+		params.Resolver,
+		params.AdditionalImageStreamTags,
+		params.AdditionalImageStreams,
+		params.AdditionalImageStreamNamespaces,
+		params.NamespaceGlobs,
+		params.SkipNamespacePatterns,
+		params.DenyByDefault,
+		buildClusterClients,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter for ImageStreamTags: %w", err)
+	}
+	return listFilteredImageStreamTags(ctx, registryClient, filter)
+}
+
+// namespaceMatchesAnyGlob returns true if the namespace matches any of the path-style
+// glob patterns. Malformed patterns never match.
+func namespaceMatchesAnyGlob(namespace string, globs []string) bool {
+	for _, glob := range globs {
+		if matches, err := path.Match(glob, namespace); err == nil && matches {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceMatchesAnyPattern returns true if the namespace matches any of the patterns
+func namespaceMatchesAnyPattern(namespace string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
 func imageStreamNameFromImageStreamTagName(nn types.NamespacedName) (types.NamespacedName, error) {
-	colonSplit := strings.Split(nn.Name, ":")
+	imageStreamName, _, err := splitImageStreamTagName(nn.Name)
+	if err != nil {
+		return types.NamespacedName{}, err
+	}
+	return types.NamespacedName{Namespace: nn.Namespace, Name: imageStreamName}, nil
+}
+
+// splitImageStreamTagName splits an imagestreamtag name in stream:tag notation into
+// the name of the stream and the tag.
+func splitImageStreamTagName(name string) (stream, tag string, err error) {
+	colonSplit := strings.Split(name, ":")
 	if n := len(colonSplit); n != 2 {
-		return types.NamespacedName{}, fmt.Errorf("splitting %s by `:` didn't yield two but %d results", nn.Name, n)
+		return "", "", fmt.Errorf("imagestreamtag name %q is not in stream:tag format: splitting it by `:` didn't yield two but %d results", name, n)
 	}
-	return types.NamespacedName{Namespace: nn.Namespace, Name: colonSplit[0]}, nil
+	return colonSplit[0], colonSplit[1], nil
 }
 
 func indexConfigsByTestInputImageStreamTag(resolver registryResolver) agents.IndexFn {
@@ -686,15 +1955,40 @@ func upsertObject(ctx context.Context, c ctrlruntimeclient.Client, obj ctrlrunti
 	return err
 }
 
+// isImportForbidden returns true if the pullSpec references a forbidden registry. Forbidden
+// registries may carry a path, in which case only the pull specs whose repository starts
+// with it are forbidden.
 func isImportForbidden(pullSpec string, forbiddenRegistries sets.String) bool {
+	host, repository := splitRegistryHost(pullSpec)
+	host = registryHostWithoutPort(host)
 	for _, reg := range forbiddenRegistries.List() {
-		if strings.HasPrefix(pullSpec, reg) {
+		regHost, regPath := splitRegistryHost(strings.TrimSuffix(reg, "/"))
+		if host == registryHostWithoutPort(regHost) && strings.HasPrefix(repository, regPath) {
 			return true
 		}
 	}
 	return false
 }
 
+// splitRegistryHost splits a pull spec or registry into the host and the remainder
+func splitRegistryHost(pullSpec string) (string, string) {
+	slashSplit := strings.SplitN(pullSpec, "/", 2)
+	if len(slashSplit) == 1 {
+		return slashSplit[0], ""
+	}
+	return slashSplit[0], slashSplit[1]
+}
+
+// registryHostWithoutPort strips the port, if any, from a registry host so that e.G. the
+// service DNS form with port and the same host without one are considered equal.
+func registryHostWithoutPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+	// The host has no port, IPv6 addresses may still be in brackets
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
 func pullSpecFromImageStreamTag(registryURL string, isTag *imagev1.ImageStreamTag) string {
 	return registryURL + "/" + isTag.Namespace + "/" + strings.Split(isTag.Name, ":")[0] + "@" + isTag.Image.ObjectMeta.Name
 }
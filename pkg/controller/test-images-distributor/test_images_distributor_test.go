@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"testing"
@@ -11,20 +12,25 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus"
 
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/util/workqueue"
+	clocktesting "k8s.io/utils/clock/testing"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	imagev1 "github.com/openshift/api/image/v1"
@@ -33,6 +39,7 @@ import (
 	testimagestreamtagimportv1 "github.com/openshift/ci-tools/pkg/api/testimagestreamtagimport/v1"
 	controllerutil "github.com/openshift/ci-tools/pkg/controller/util"
 	"github.com/openshift/ci-tools/pkg/load/agents"
+	"github.com/openshift/ci-tools/pkg/testhelper"
 )
 
 func init() {
@@ -196,6 +203,24 @@ func TestReconcile(t *testing.T) {
 		return copy
 	}
 
+	otherImageStreamTag := func() *imagev1.ImageStreamTag {
+		copy := referenceImageStreamTag.DeepCopy()
+		copy.Name = "4.2:Answer"
+		return copy
+	}
+
+	// The imagestream and tag 4.3:Question are next to the reference ones in the same namespace
+	neighbourImageStream := func() *imagev1.ImageStream {
+		copy := referenceImageStream.DeepCopy()
+		copy.Name = "4.3"
+		return copy
+	}
+	neighbourImageStreamTag := func() *imagev1.ImageStreamTag {
+		copy := referenceImageStreamTag.DeepCopy()
+		copy.Name = "4.3:Question"
+		return copy
+	}
+
 	outdatedImageStreamTag := func() *imagev1.ImageStreamTag {
 		copy := referenceImageStreamTag.DeepCopy()
 		copy.Image.Name = "old"
@@ -270,6 +295,7 @@ func TestReconcile(t *testing.T) {
 			Name:      strings.Split(referenceImageStreamTag.Name, ":")[0],
 			Annotations: map[string]string{
 				"release.openshift.io/config": "bar",
+				defaultManagedByAnnotation:    ControllerName,
 			},
 		},
 		Spec: imagev1.ImageStreamSpec{
@@ -285,11 +311,24 @@ func TestReconcile(t *testing.T) {
 		return copy
 	}
 
+	pinnedImageStream := func() *imagev1.ImageStream {
+		copy := expectedImageStream.DeepCopy()
+		copy.Spec.Tags = []imagev1.TagReference{{
+			Name:        "Question",
+			Annotations: map[string]string{pinAnnotation: "sha256:328d0a90295ef5f5932807bcab8f230007afeb1572d1d7878ab8bdae671dfa8b"},
+		}}
+		return copy
+	}
+
 	ctx := context.Background()
 	verifyEverythingCreated := func(c ctrlruntimeclient.Client) error {
-		if err := c.Get(ctx, types.NamespacedName{Name: expectedNamespace.Name}, &corev1.Namespace{}); err != nil {
+		namespace := &corev1.Namespace{}
+		if err := c.Get(ctx, types.NamespacedName{Name: expectedNamespace.Name}, namespace); err != nil {
 			return fmt.Errorf("expected namespace %s, but failed to get it: %w", expectedNamespace.Name, err)
 		}
+		if requester := namespace.Annotations[api.DPTPRequesterLabel]; requester != ControllerName {
+			return fmt.Errorf("expected namespace %s to have requester %s, got %q", expectedNamespace.Name, ControllerName, requester)
+		}
 
 		pullSecret := &corev1.Secret{}
 		pullScretName := types.NamespacedName{
@@ -373,16 +412,134 @@ func TestReconcile(t *testing.T) {
 		return nil
 	}
 
+	importer := &recordingImporter{}
+	failingImporter := &recordingImporter{err: errors.New("registry is down")}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	createdAgo := func(age time.Duration) *imagev1.ImageStreamTag {
+		copy := referenceImageStreamTag.DeepCopy()
+		copy.Image.CreationTimestamp = metav1.NewTime(now.Add(-age))
+		return copy
+	}
+
+	expiringImageStream := func(expiresAt time.Time) *imagev1.ImageStream {
+		stream := &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: referenceImageStream.Namespace, Name: referenceImageStream.Name}}
+		if !expiresAt.IsZero() {
+			stream.Annotations = map[string]string{expiresAtAnnotation: expiresAt.Format(time.RFC3339)}
+		}
+		return stream
+	}
+	verifyExpiry := func(c ctrlruntimeclient.Client, expected time.Time) error {
+		stream := &imagev1.ImageStream{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: referenceImageStream.Namespace, Name: referenceImageStream.Name}, stream); err != nil {
+			return fmt.Errorf("failed to get imagestream: %w", err)
+		}
+		if actual, expected := stream.Annotations[expiresAtAnnotation], expected.Format(time.RFC3339); actual != expected {
+			return fmt.Errorf("expected the imagestream to expire at %s, got %q", expected, actual)
+		}
+		return nil
+	}
+
+	// Reconcile requeues all errors that are not terminal
+	verifyRequeued := func(expected bool) func(ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) error {
+		return func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
+			if requeued := controllerutil.SwallowIfTerminal(terminalIfPermanent(err)) != nil; requeued != expected {
+				return fmt.Errorf("expected requeue: %t, got error %v", expected, err)
+			}
+			return nil
+		}
+	}
+	// Reconcile requeues requeueAfterErrors after their interval without returning them
+	verifyRequeuedAfter := func(expected time.Duration) func(ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) error {
+		return func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
+			var requeue requeueAfterError
+			if !errors.As(err, &requeue) {
+				return fmt.Errorf("expected to get requeued after %s, got error %v", expected, err)
+			}
+			if requeue.after != expected {
+				return fmt.Errorf("expected to get requeued after %s, got %s", expected, requeue.after)
+			}
+			return nil
+		}
+	}
+	verifyInvalidRequest := func(expected error) func(ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) error {
+		return func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
+			if diff := cmp.Diff(expected, err, testhelper.EquateErrorMessage); diff != "" {
+				return fmt.Errorf("error differs from expected: %s", diff)
+			}
+			if !controllerutil.IsTerminal(err) {
+				return fmt.Errorf("expected error to be terminal, got %w", err)
+			}
+			return nil
+		}
+	}
+	erroringRegistryClient := func(err error) ctrlruntimeclient.Client {
+		return &erroringGetClient{Client: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()), err: err}
+	}
+
+	annotatedImageStream := func(key, value string) *imagev1.ImageStream {
+		copy := referenceImageStream.DeepCopy()
+		copy.Annotations[key] = value
+		return copy
+	}
+
+	pauseConfigMap := func(paused string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "test-images-distributor"},
+			Data:       map[string]string{pausedKey: paused},
+		}
+	}
+
+	verifyReferencePolicy := func(c ctrlruntimeclient.Client, expected imagev1.TagReferencePolicyType) error {
+		imageStreamImport := &imagev1.ImageStreamImport{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStreamImport); err != nil {
+			return fmt.Errorf("failed to get import: %w", err)
+		}
+		if actual := imageStreamImport.Spec.Images[0].ReferencePolicy.Type; actual != expected {
+			return fmt.Errorf("expected reference policy %s, got %s", expected, actual)
+		}
+		return nil
+	}
+
 	testCases := []struct {
-		name                string
-		request             types.NamespacedName
-		registryClient      ctrlruntimeclient.Client
-		buildClusterClients map[string]ctrlruntimeclient.Client
-		verify              func(ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) error
+		name                  string
+		request               types.NamespacedName
+		registryClient        ctrlruntimeclient.Client
+		buildClusterClients   map[string]ctrlruntimeclient.Client
+		destinationNamespace  func(cluster, namespace string) string
+		destinationTag        func(string) string
+		deniedDigests         sets.String
+		pruneRemovedTags      bool
+		requester             string
+		importer              Importer
+		scheduledImports      bool
+		propagateSourceCommit bool
+		copySignatures        bool
+		copyTagAnnotations    bool
+		compareContentDigest  bool
+		skipNewerDestinations bool
+		propagatedImageLabels []string
+		minImageAge           time.Duration
+		referencePolicies     map[string]imagev1.TagReferencePolicyType
+		defaultPolicy         imagev1.TagReferencePolicyType
+		pauseConfigMap        *types.NamespacedName
+		destinationTTL        time.Duration
+		// releasePayloadAnnotation is passed as is, so unset means the default
+		releasePayloadAnnotation string
+		// expectedSourceImageAge is checked to be the only observed source image age if set
+		expectedSourceImageAge time.Duration
+		// importLatency makes the import take that long according to the clock and is
+		// checked to be the only observed import duration if set
+		importLatency time.Duration
+		// concurrentRequests get reconciled in parallel to the request and must not fail
+		concurrentRequests []types.NamespacedName
+		verify             func(ctrlruntimeclient.Client, map[string]ctrlruntimeclient.Client, error) error
+		expectedAction     action
+		expectedSkipReason string
 	}{
 		{
 			name:                "Request for non existent object doesn't error",
-			request:             types.NamespacedName{Namespace: "01_doesnotexist/doesnotexist"},
+			expectedAction:      actionNoop,
+			request:             types.NamespacedName{Namespace: "01_doesnotexist", Name: "doesnotexist:latest"},
 			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy()),
 			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient()},
 			verify: func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
@@ -393,8 +550,9 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name:    "Request for non-existent cluster yields terminal error",
-			request: types.NamespacedName{Namespace: "01_doesnotexist", Name: "doesnotexist"},
+			name:           "Request for non-existent cluster yields terminal error",
+			expectedAction: actionNoop,
+			request:        types.NamespacedName{Namespace: "01_doesnotexist", Name: "doesnotexist:latest"},
 			verify: func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
 				if err == nil {
 					return errors.New("expected error, got none")
@@ -406,13 +564,32 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "ImageStreamTag with build01 reference, no import is created",
+			name:           "Client for cluster is nil, reconciliation is skipped",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": nil, "02": fakeclient.NewFakeClient()},
+			expectedSkipReason:  skipReasonClientUnavailable,
+			verify: func(_ ctrlruntimeclient.Client, _ map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag with build01 reference, no import is created",
+			expectedAction: actionNoop,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
 			},
 			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), imageStreamTagWithBuild01PullSpec()),
 			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient()},
+			expectedSkipReason:  skipReasonDenied,
 			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
 				if err != nil {
 					return fmt.Errorf("unexpected error: %w", err)
@@ -428,13 +605,15 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "ImageStreamTag is current, no import created",
+			name:           "ImageStreamTag is current, no import created",
+			expectedAction: actionSkippedSameDigest,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
 			},
 			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
 			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy())},
+			expectedSkipReason:  skipReasonSameDigest,
 			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
 				if err != nil {
 					return fmt.Errorf("unexpected error: %w", err)
@@ -450,7 +629,189 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag, Namespace, pull secret, imagestream and import and rbac are created",
+			name:           "Build cluster uses the registry of the registry cluster, no import created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "app.ci_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"app.ci": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedSkipReason:  skipReasonSameRegistry,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["app.ci"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag on the build cluster is newer than the source, no import created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStreamTag {
+					copy := outdatedImageStreamTag()
+					copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC))
+					return copy
+				}(),
+			))},
+			skipNewerDestinations: true,
+			expectedSkipReason:    skipReasonDestinationNewer,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag on the build cluster is newer than the source but the source is forced, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Annotations = map[string]string{forceSyncAnnotation: "true"}
+				copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStreamTag {
+					copy := outdatedImageStreamTag()
+					copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC))
+					return copy
+				}(),
+			))},
+			skipNewerDestinations: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("expected import to be created, got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag on the build cluster is older than the source, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStreamTag {
+					copy := outdatedImageStreamTag()
+					copy.Image.CreationTimestamp = metav1.NewTime(time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC))
+					return copy
+				}(),
+			))},
+			skipNewerDestinations: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("expected import to be created, got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag has a different digest but the same content digest, no import created",
+			expectedAction: actionSkippedSameDigest,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Annotations = map[string]string{contentDigestAnnotation: "sha256:content"}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(func() *imagev1.ImageStreamTag {
+				copy := outdatedImageStreamTag()
+				copy.Image.Annotations = map[string]string{contentDigestAnnotation: "sha256:content"}
+				return copy
+			}())},
+			compareContentDigest: true,
+			expectedSkipReason:   skipReasonSameDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag has a different content digest, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Annotations = map[string]string{contentDigestAnnotation: "sha256:content"}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStreamTag {
+					copy := outdatedImageStreamTag()
+					copy.Image.Annotations = map[string]string{contentDigestAnnotation: "sha256:other"}
+					return copy
+				}(),
+			))},
+			compareContentDigest: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("expected import to be created, got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Outdated imageStreamtag, Namespace, pull secret, imagestream and import and rbac are created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -465,7 +826,8 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag, pull secret, imagestream, import and rbac are created",
+			name:           "Outdated imageStreamtag, pull secret, imagestream, import and rbac are created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -484,7 +846,8 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag and pull secret, pull secret is updated, imagestream import and rbac created",
+			name:           "Outdated imageStreamtag and pull secret, pull secret is updated, imagestream import and rbac created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -504,7 +867,8 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag and rbac, rbac updated, imagestream and import created",
+			name:           "Outdated imageStreamtag and rbac, rbac updated, imagestream and import created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -526,7 +890,8 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated Imagestream is updated, import is created",
+			name:           "Outdated Imagestream is updated, import is created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -547,7 +912,81 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag, import is created",
+			name:           "Outdated imageStreamtag, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedPullSecret.DeepCopy(),
+				expectedImageStream.DeepCopy(),
+			))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:           "Source pull secret has no data yet, no import is created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "registry-pull-credentials"}},
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedImageStream.DeepCopy(),
+			))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				exp := "failed to ensure imagePullSecret on cluster 01: pull secret not available yet: source secret ci/registry-pull-credentials has no data"
+				if err == nil || err.Error() != exp {
+					return fmt.Errorf("expected error message %s, got %w", exp, err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: expectedImageStream.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Outdated imageStreamtag with a denied digest, no import is created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+			))},
+			deniedDigests:      sets.NewString(referenceImageStreamTag.Image.Name),
+			expectedSkipReason: skipReasonDeniedDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: expectedImageStream.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Outdated imageStreamtag with a digest that is not denied, import is created",
+			expectedAction: actionImported,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -560,6 +999,7 @@ func TestReconcile(t *testing.T) {
 				expectedPullSecret.DeepCopy(),
 				expectedImageStream.DeepCopy(),
 			))},
+			deniedDigests: sets.NewString("sha256:328d0a90295ef5f5932807bcab8f230007afeb1572d1d7878ab8bdae671dfa8b"),
 			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
 				if err != nil {
 					return fmt.Errorf("unexpected error: %w", err)
@@ -568,7 +1008,35 @@ func TestReconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "Outdated imageStreamtag, import is created, failure is returned",
+			name:           "Outdated imageStreamtag is pinned on the build cluster, no import is created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedPullSecret.DeepCopy(),
+				pinnedImageStream(),
+			))},
+			expectedSkipReason: skipReasonPinned,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: expectedImageStream.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Outdated imageStreamtag, import is created, failure is returned",
+			expectedAction: actionNoop,
 			request: types.NamespacedName{
 				Namespace: "01_" + referenceImageStreamTag.Namespace,
 				Name:      referenceImageStreamTag.Name,
@@ -590,340 +1058,2558 @@ func TestReconcile(t *testing.T) {
 				return nil
 			},
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			tc := tc
-			// Needed so the racedetector tells us if we accidentally re-use global state, e.G. by not deepcopying
-			t.Parallel()
-			log := logrus.NewEntry(logrus.StandardLogger())
-			logrus.SetLevel(logrus.TraceLevel)
-			r := &reconciler{
-				log:                 log,
-				registryClusterName: "app.ci",
-				registryClient:      tc.registryClient,
-				buildClusterClients: tc.buildClusterClients,
-				forbiddenRegistries: sets.NewString("default-route-openshift-image-registry.apps.build01.ci.devcluster.openshift.com",
+		{
+			name:           "Outdated imageStreamtag, import partially succeeds, failed images are returned",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedPullSecret.DeepCopy(),
+				expectedImageStream.DeepCopy(),
+			), func(c *imageImportStatusSettingClient) {
+				c.statuses = []imagev1.ImageImportStatus{
+					{Tag: "other", Image: &imagev1.Image{}},
+					{Tag: "Question", Status: metav1.Status{Reason: metav1.StatusReasonUnauthorized, Message: "authentication required"}},
+				}
+			},
+			)},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				exp := "imageStreamImport did not succeed: tag Question: reason: Unauthorized, message: authentication required"
+				if err == nil || err.Error() != exp {
+					return fmt.Errorf("expected error message %s, got %w", exp, err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Outdated imageStreamtag, import never gets a status, timeout is returned",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedPullSecret.DeepCopy(),
+				expectedImageStream.DeepCopy(),
+			), func(c *imageImportStatusSettingClient) { c.hang = true },
+			)},
+			importer: clientImporter{timeout: 100 * time.Millisecond},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				exp := "imageStreamImport status not ready within deadline: context deadline exceeded"
+				if err == nil || err.Error() != exp {
+					return fmt.Errorf("expected error message %s, got %w", exp, err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Importer is set, import goes through it",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			)},
+			importer: importer,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				expected := []string{"01: ns/4.2: registry.ci.openshift.org/ns/4.2@sha256:a273f5ac7f1ad8f7ffab45205ac36c8dff92d9107ef3ae429eeb135fa8057b8b -> Question"}
+				if diff := cmp.Diff(expected, importer.imported); diff != "" {
+					return fmt.Errorf("imports differ from expected: %s", diff)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Importer fails, error is returned",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			)},
+			importer: failingImporter,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err == nil || err.Error() != "registry is down" {
+					return fmt.Errorf("expected error registry is down, got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Destination namespace is remapped, namespace is created and import lands there",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			))},
+			destinationNamespace: func(_, namespace string) string { return namespace + "-mirror" },
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				const targetNamespace = "ns-mirror"
+				if err := bc["01"].Get(ctx, types.NamespacedName{Name: targetNamespace}, &corev1.Namespace{}); err != nil {
+					return fmt.Errorf("expected namespace %s, but failed to get it: %w", targetNamespace, err)
+				}
+				importName := types.NamespacedName{Namespace: targetNamespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, importName, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("failed to get import %s: %w", importName.String(), err)
+				}
+				streamName := types.NamespacedName{Namespace: targetNamespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, streamName, &imagev1.ImageStream{}); err != nil {
+					return fmt.Errorf("failed to get imagestream %s: %w", streamName.String(), err)
+				}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Name: referenceImageStreamTag.Namespace}, &corev1.Namespace{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected source namespace not to be created, but got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Destination tag is remapped, import lands in the remapped tag",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			))},
+			destinationTag: func(tag string) string {
+				if tag == "Question" {
+					return "stable"
+				}
+				return tag
+			},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				importName := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				imageStreamImport := &imagev1.ImageStreamImport{}
+				if err := bc["01"].Get(ctx, importName, imageStreamImport); err != nil {
+					return fmt.Errorf("failed to get import %s: %w", importName.String(), err)
+				}
+				if to := imageStreamImport.Spec.Images[0].To.Name; to != "stable" {
+					return fmt.Errorf("expected import to tag stable, got %s", to)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag was removed from source imageStream, pruning is enabled, it is deleted on the build cluster",
+			expectedAction: actionDeleted,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				referenceImageStreamTag.DeepCopy(),
+				otherImageStreamTag(),
+			))},
+			pruneRemovedTags: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamTag{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected imageStreamTag to be deleted, but got %v", err)
+				}
+				otherName := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: otherImageStreamTag().Name}
+				if err := bc["01"].Get(ctx, otherName, &imagev1.ImageStreamTag{}); err != nil {
+					return fmt.Errorf("expected other imageStreamTag to remain, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "ImageStreamTag was removed from source imageStream, pruning is disabled, it is left alone",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy()))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamTag{}); err != nil {
+					return fmt.Errorf("expected imageStreamTag to remain, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source imageStream is gone, imageStreamTag on the build cluster is left alone",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy()))},
+			pruneRemovedTags:    true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamTag{}); err != nil {
+					return fmt.Errorf("expected imageStreamTag to still exist, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Target namespace is terminating, reconcile is a no-op",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: referenceImageStreamTag.Namespace},
+					Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+				},
+			))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStream{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected to get not found err, but got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Target imagestream is missing from the cache but exists, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(&staleImageStreamCacheClient{Client: fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			)})},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("failed to get import %s: %w", name, err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Scheduled imports are enabled, import has a scheduled import policy",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+			))},
+			scheduledImports: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				imageStreamImport := &imagev1.ImageStreamImport{}
+				if err := bc["01"].Get(ctx, name, imageStreamImport); err != nil {
+					return fmt.Errorf("failed to get import %s: %w", name, err)
+				}
+				if !imageStreamImport.Spec.Images[0].ImportPolicy.Scheduled {
+					return errors.New("expected import policy to be scheduled, wasn't the case")
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source commit propagation is enabled, imported tag is annotated with the commit",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Annotations = map[string]string{commitAnnotation: "8f1ba27"}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStream {
+					copy := expectedImageStream.DeepCopy()
+					copy.Spec.Tags = []imagev1.TagReference{{Name: "Question"}}
+					return copy
+				}(),
+			))},
+			propagateSourceCommit: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				imageStream := &imagev1.ImageStream{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStream); err != nil {
+					return fmt.Errorf("failed to get imagestream: %w", err)
+				}
+				if commit := imageStream.Spec.Tags[0].Annotations[commitAnnotation]; commit != "8f1ba27" {
+					return fmt.Errorf("expected tag to be annotated with commit 8f1ba27, got %q", commit)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Tag annotation copying is enabled, imported tag gets the prefix-matched annotations",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Annotations = map[string]string{
+					"release.openshift.io/config":                      "tag-config",
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStream {
+					copy := expectedImageStream.DeepCopy()
+					copy.Spec.Tags = []imagev1.TagReference{{Name: "Question"}}
+					return copy
+				}(),
+			))},
+			copyTagAnnotations: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				imageStream := &imagev1.ImageStream{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStream); err != nil {
+					return fmt.Errorf("failed to get imagestream: %w", err)
+				}
+				if diff := cmp.Diff(map[string]string{"release.openshift.io/config": "tag-config"}, imageStream.Spec.Tags[0].Annotations); diff != "" {
+					return fmt.Errorf("tag annotations differ from expected: %s", diff)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Image label propagation is enabled, imported tag gets the selected labels as annotations",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.DockerImageMetadata.Raw = []byte(`{"Config":{"Labels":{"version":"4.2.0","vendor":"Red Hat","io.openshift.build.commit.id":"8f1ba27"}}}`)
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStream {
+					copy := expectedImageStream.DeepCopy()
+					copy.Spec.Tags = []imagev1.TagReference{{Name: "Question"}}
+					return copy
+				}(),
+			))},
+			propagatedImageLabels: []string{"version", "release"},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				imageStream := &imagev1.ImageStream{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStream); err != nil {
+					return fmt.Errorf("failed to get imagestream: %w", err)
+				}
+				if diff := cmp.Diff(map[string]string{"version": "4.2.0"}, imageStream.Spec.Tags[0].Annotations); diff != "" {
+					return fmt.Errorf("tag annotations differ from expected: %s", diff)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Image label propagation is enabled but source image has no metadata, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				func() *imagev1.ImageStream {
+					copy := expectedImageStream.DeepCopy()
+					copy.Spec.Tags = []imagev1.TagReference{{Name: "Question"}}
+					return copy
+				}(),
+			))},
+			propagatedImageLabels: []string{"version"},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				imageStream := &imagev1.ImageStream{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStream); err != nil {
+					return fmt.Errorf("failed to get imagestream: %w", err)
+				}
+				if annotations := imageStream.Spec.Tags[0].Annotations; len(annotations) != 0 {
+					return fmt.Errorf("expected no tag annotations, got %v", annotations)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source commit propagation is enabled but source has no commit, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				outdatedImageStreamTag(),
+				expectedNamespace.DeepCopy(),
+				expectedPullSecret.DeepCopy(),
+				expectedImageStream.DeepCopy(),
+			))},
+			propagateSourceCommit: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:           "Signature copying is enabled, signatures of the source image are created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Signatures = []imagev1.ImageSignature{
+					{ObjectMeta: metav1.ObjectMeta{Name: copy.Image.Name + "@first"}, Type: "atomic", Content: []byte("first")},
+					{ObjectMeta: metav1.ObjectMeta{Name: copy.Image.Name + "@second"}, Type: "atomic", Content: []byte("second")},
+				}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				&imagev1.ImageSignature{ObjectMeta: metav1.ObjectMeta{Name: referenceImageStreamTag.Image.Name + "@first"}, Type: "atomic", Content: []byte("first")},
+			))},
+			copySignatures: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				for _, name := range []string{"first", "second"} {
+					signature := &imagev1.ImageSignature{}
+					if err := bc["01"].Get(ctx, types.NamespacedName{Name: referenceImageStreamTag.Image.Name + "@" + name}, signature); err != nil {
+						return fmt.Errorf("failed to get signature %s: %w", name, err)
+					}
+					if content := string(signature.Content); content != name {
+						return fmt.Errorf("expected signature %s to have content %q, got %q", name, name, content)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Namespace is created with the configured requester",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+			))},
+			requester: "another_syncer",
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				namespace := &corev1.Namespace{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Name: referenceImageStreamTag.Namespace}, namespace); err != nil {
+					return fmt.Errorf("failed to get namespace: %w", err)
+				}
+				if diff := cmp.Diff(map[string]string{api.DPTPRequesterLabel: "another_syncer"}, namespace.Annotations); diff != "" {
+					return fmt.Errorf("namespace annotations differ from expected: %s", diff)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Requester annotation is added to existing namespace without removing other annotations",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(
+				secret.DeepCopy(),
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        referenceImageStreamTag.Namespace,
+					Annotations: map[string]string{"openshift.io/description": "keep me"},
+				}},
+			))},
+			requester: "another_syncer",
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				namespace := &corev1.Namespace{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Name: referenceImageStreamTag.Namespace}, namespace); err != nil {
+					return fmt.Errorf("failed to get namespace: %w", err)
+				}
+				expected := map[string]string{
+					"openshift.io/description": "keep me",
+					api.DPTPRequesterLabel:     "another_syncer",
+				}
+				if diff := cmp.Diff(expected, namespace.Annotations); diff != "" {
+					return fmt.Errorf("namespace annotations differ from expected: %s", diff)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Imagestream is restricted to the cluster, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(func() *imagev1.ImageStream {
+				copy := referenceImageStream.DeepCopy()
+				copy.Annotations[syncToAnnotation] = "01, 02"
+				return copy
+			}(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:           "Imagestream is restricted to other clusters, nothing is imported",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(func() *imagev1.ImageStream {
+				copy := referenceImageStream.DeepCopy()
+				copy.Annotations[syncToAnnotation] = "02,03"
+				return copy
+			}(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedSkipReason:  skipReasonUnmanaged,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Tag is current but misses the commit annotation, annotation is added",
+			expectedAction: actionSkippedSameDigest,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Annotations = map[string]string{commitAnnotation: "8f1ba27"}
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(
+				referenceImageStreamTag.DeepCopy(),
+				func() *imagev1.ImageStream {
+					copy := expectedImageStream.DeepCopy()
+					copy.Spec.Tags = []imagev1.TagReference{{Name: "Question"}}
+					return copy
+				}(),
+			)},
+			propagateSourceCommit: true,
+			expectedSkipReason:    skipReasonSameDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				imageStream := &imagev1.ImageStream{}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}, imageStream); err != nil {
+					return fmt.Errorf("failed to get imagestream: %w", err)
+				}
+				if commit := imageStream.Spec.Tags[0].Annotations[commitAnnotation]; commit != "8f1ba27" {
+					return fmt.Errorf("expected tag to be annotated with commit 8f1ba27, got %q", commit)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Imported tag is not in the imagestream, annotating fails so it gets retried",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Annotations = map[string]string{commitAnnotation: "8f1ba27"}
+				return copy
+			}()),
+			buildClusterClients:   map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			propagateSourceCommit: true,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				expected := "failed to annotate tag ns/4.2:Question: imagestream ns/4.2 has no tag Question"
+				if err == nil || err.Error() != expected {
+					return fmt.Errorf("expected error %q, got %v", expected, err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Image is younger than the minimum age, it is requeued for the remaining time",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), createdAgo(time.Minute)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			minImageAge:         10 * time.Minute,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				var requeue requeueAfterError
+				if !errors.As(err, &requeue) || requeue.after != 9*time.Minute {
+					return fmt.Errorf("expected to get requeued after 9m, got %v", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Image is older than the minimum age, it is imported",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), createdAgo(time.Hour)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			minImageAge:         10 * time.Minute,
+			// The age is observed even for images that are not imported
+			expectedSourceImageAge: time.Hour,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:           "Cluster has a reference policy, import uses it",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			defaultPolicy:       imagev1.LocalTagReferencePolicy,
+			referencePolicies:   map[string]imagev1.TagReferencePolicyType{"01": imagev1.SourceTagReferencePolicy},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyReferencePolicy(bc["01"], imagev1.SourceTagReferencePolicy)
+			},
+		},
+		{
+			name:           "Only other clusters have a reference policy, import uses the default",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			defaultPolicy:       imagev1.SourceTagReferencePolicy,
+			referencePolicies:   map[string]imagev1.TagReferencePolicyType{"02": imagev1.LocalTagReferencePolicy},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyReferencePolicy(bc["01"], imagev1.SourceTagReferencePolicy)
+			},
+		},
+		{
+			name:           "Distribution is paused, request is requeued without importing",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy(), pauseConfigMap("true")),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			pauseConfigMap:      &types.NamespacedName{Namespace: "ci", Name: "test-images-distributor"},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				var requeue requeueAfterError
+				if !errors.As(err, &requeue) || requeue.after != pausedRequeueInterval {
+					return fmt.Errorf("expected to get requeued after %s, got %v", pausedRequeueInterval, err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Distribution is resumed, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy(), pauseConfigMap("false")),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			pauseConfigMap:      &types.NamespacedName{Namespace: "ci", Name: "test-images-distributor"},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:           "Destination namespace depends on the cluster, import lands in the namespace of the requested cluster",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "02_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy())),
+				"02": bcc(fakeclient.NewFakeClient(secret.DeepCopy())),
+			},
+			destinationNamespace: func(cluster, namespace string) string { return "build" + cluster + "-" + namespace },
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				const targetNamespace = "build02-ns"
+				if err := bc["02"].Get(ctx, types.NamespacedName{Name: targetNamespace}, &corev1.Namespace{}); err != nil {
+					return fmt.Errorf("expected namespace %s, but failed to get it: %w", targetNamespace, err)
+				}
+				importName := types.NamespacedName{Namespace: targetNamespace, Name: "4.2"}
+				if err := bc["02"].Get(ctx, importName, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("failed to get import %s: %w", importName.String(), err)
+				}
+				if err := bc["01"].Get(ctx, types.NamespacedName{Name: "build01-ns"}, &corev1.Namespace{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected nothing to be created on the other cluster, but got %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Tag is current and the imagestream has no expiry, expiry is stamped",
+			expectedAction: actionSkippedSameDigest,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy(), expiringImageStream(time.Time{}))},
+			destinationTTL:      24 * time.Hour,
+			expectedSkipReason:  skipReasonSameDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyExpiry(bc["01"], now.Add(24*time.Hour))
+			},
+		},
+		{
+			name:           "Tag is current and the expiry is close, expiry is refreshed",
+			expectedAction: actionSkippedSameDigest,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy(), expiringImageStream(now.Add(time.Hour)))},
+			destinationTTL:      24 * time.Hour,
+			expectedSkipReason:  skipReasonSameDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyExpiry(bc["01"], now.Add(24*time.Hour))
+			},
+		},
+		{
+			name:           "Tag is current and the expiry lies far ahead, expiry is kept",
+			expectedAction: actionSkippedSameDigest,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": fakeclient.NewFakeClient(referenceImageStreamTag.DeepCopy(), expiringImageStream(now.Add(20*time.Hour)))},
+			destinationTTL:      24 * time.Hour,
+			expectedSkipReason:  skipReasonSameDigest,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyExpiry(bc["01"], now.Add(20*time.Hour))
+			},
+		},
+		{
+			name:           "Import creates the imagestream, expiry is stamped",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			destinationTTL:      24 * time.Hour,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("expected import to be created, got %w", err)
+				}
+				return verifyExpiry(bc["01"], now.Add(24*time.Hour))
+			},
+		},
+		{
+			name:           "Source imagestream is a release payload, no import created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(annotatedImageStream(defaultReleasePayloadAnnotation, "ocp/4.12"), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedSkipReason:  skipReasonReleasePayload,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source imagestream is a release payload according to a custom annotation, no import created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:           fakeclient.NewFakeClient(annotatedImageStream("example.com/payload", "ocp/4.12"), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients:      map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			releasePayloadAnnotation: "example.com/payload",
+			expectedSkipReason:       skipReasonReleasePayload,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source imagestream has the default release payload annotation but a custom one is configured, import is created",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:           fakeclient.NewFakeClient(annotatedImageStream(defaultReleasePayloadAnnotation, "ocp/4.12"), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients:      map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			releasePayloadAnnotation: "example.com/payload",
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); err != nil {
+					return fmt.Errorf("expected import to be created, got %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source image has no name yet, retryable error and no import created",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.Name = ""
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if diff := cmp.Diff(errors.New("source image not fully populated for tag ns/4.2:Question"), err, testhelper.EquateErrorMessage); diff != "" {
+					return fmt.Errorf("error differs from expected: %s", diff)
+				}
+				if controllerutil.IsTerminal(err) {
+					return fmt.Errorf("expected error to be retryable, got terminal error %w", err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Source image has no docker image reference yet, request is requeued without importing",
+			expectedAction: actionNoop,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), func() *imagev1.ImageStreamTag {
+				copy := referenceImageStreamTag.DeepCopy()
+				copy.Image.DockerImageReference = ""
+				return copy
+			}()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				var requeue requeueAfterError
+				if !errors.As(err, &requeue) || requeue.after != unmaterializedImageRequeueInterval {
+					return fmt.Errorf("expected to get requeued after %s, got %v", unmaterializedImageRequeueInterval, err)
+				}
+				name := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: "4.2"}
+				if err := bc["01"].Get(ctx, name, &imagev1.ImageStreamImport{}); !apierrors.IsNotFound(err) {
+					return fmt.Errorf("expected no import, got err %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Import takes a while, its duration is observed",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			importLatency:       3 * time.Second,
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:                "Request that can't be decoded is not requeued",
+			request:             types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      erroringRegistryClient(apierrors.NewInternalError(errors.New("unreachable"))),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(false),
+		},
+		{
+			name:                "Malformed imagestreamtag name is not requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name + ":again"},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(false),
+		},
+		{
+			name:                "Bad request from the registry cluster is not requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      erroringRegistryClient(apierrors.NewBadRequest("nope")),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(false),
+		},
+		{
+			name:                "Invalid object on the registry cluster is not requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      erroringRegistryClient(apierrors.NewInvalid(imagev1.GroupVersion.WithKind("ImageStreamTag").GroupKind(), referenceImageStreamTag.Name, nil)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(false),
+		},
+		{
+			name:                "Internal server error of the registry cluster is requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      erroringRegistryClient(apierrors.NewInternalError(errors.New("try again"))),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(true),
+		},
+		{
+			name:                "Server timeout of the registry cluster is requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      erroringRegistryClient(apierrors.NewServerTimeout(imagev1.Resource("imagestreamtags"), "get", 1)),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeued(true),
+		},
+		{
+			name:           "Namespace gets created concurrently, it still gets the requester annotation",
+			expectedAction: actionImported,
+			request: types.NamespacedName{
+				Namespace: "01_" + referenceImageStreamTag.Namespace,
+				Name:      referenceImageStreamTag.Name,
+			},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(&concurrentNamespaceCreationClient{Client: fakeclient.NewFakeClient(secret.DeepCopy())})},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				return verifyEverythingCreated(bc["01"])
+			},
+		},
+		{
+			name:                "Import that conflicts with a concurrent one is requeued",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": &conflictingImportClient{Client: fakeclient.NewFakeClient(secret.DeepCopy())}},
+			expectedAction:      actionNoop,
+			verify:              verifyRequeuedAfter(conflictingImportRequeueInterval),
+		},
+		{
+			name:           "Requests for other clusters and imagestreams are reconciled concurrently",
+			expectedAction: actionImported,
+			request:        types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+			concurrentRequests: []types.NamespacedName{
+				{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: neighbourImageStreamTag().Name},
+				{Namespace: "02_" + referenceImageStreamTag.Namespace, Name: referenceImageStreamTag.Name},
+				{Namespace: "02_" + referenceImageStreamTag.Namespace, Name: neighbourImageStreamTag().Name},
+			},
+			registryClient: fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy(), neighbourImageStream(), neighbourImageStreamTag()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy())),
+				"02": bcc(fakeclient.NewFakeClient(secret.DeepCopy())),
+			},
+			verify: func(rc ctrlruntimeclient.Client, bc map[string]ctrlruntimeclient.Client, err error) error {
+				if err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				for cluster, client := range bc {
+					if err := verifyEverythingCreated(client); err != nil {
+						return fmt.Errorf("cluster %s: %w", cluster, err)
+					}
+					neighbourImport := types.NamespacedName{Namespace: referenceImageStreamTag.Namespace, Name: neighbourImageStream().Name}
+					if err := client.Get(ctx, neighbourImport, &imagev1.ImageStreamImport{}); err != nil {
+						return fmt.Errorf("cluster %s: failed to get import %s: %w", cluster, neighbourImport, err)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:                "Request with an empty namespace is rejected",
+			request:             types.NamespacedName{Name: referenceImageStreamTag.Name},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyInvalidRequest(errors.New("invalid request /4.2:Question: namespace is empty")),
+		},
+		{
+			name:                "Request with an empty name is rejected",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyInvalidRequest(errors.New("invalid request 01_ns/: name is empty")),
+		},
+		{
+			name:                "Request with a name that is not in stream:tag format is rejected",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: "4.2"},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyInvalidRequest(errors.New("invalid request 01_ns/4.2: imagestreamtag name \"4.2\" is not in stream:tag format: splitting it by `:` didn't yield two but 1 results")),
+		},
+		{
+			name:                "Request with an empty tag is rejected",
+			request:             types.NamespacedName{Namespace: "01_" + referenceImageStreamTag.Namespace, Name: "4.2:"},
+			registryClient:      fakeclient.NewFakeClient(referenceImageStream.DeepCopy(), referenceImageStreamTag.DeepCopy()),
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"01": bcc(fakeclient.NewFakeClient(secret.DeepCopy()))},
+			expectedAction:      actionNoop,
+			verify:              verifyInvalidRequest(errors.New("invalid request 01_ns/4.2:: imagestreamtag name \"4.2:\" is not in stream:tag format: stream and tag must not be empty")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			// Needed so the racedetector tells us if we accidentally re-use global state, e.G. by not deepcopying
+			t.Parallel()
+			log := logrus.NewEntry(logrus.StandardLogger())
+			logrus.SetLevel(logrus.TraceLevel)
+			clock := clocktesting.NewFakeClock(now)
+			importer := tc.importer
+			if tc.importLatency != 0 {
+				importer = clockSteppingImporter{clock: clock, latency: tc.importLatency}
+			}
+			r := &reconciler{
+				log:                 log,
+				registryClusterName: "app.ci",
+				registryClient:      tc.registryClient,
+				buildClusterClients: tc.buildClusterClients,
+				forbiddenRegistries: sets.NewString("default-route-openshift-image-registry.apps.build01.ci.devcluster.openshift.com",
 					"registry.build01.ci.openshift.org",
 					"registry.build02.ci.openshift.org",
 				),
+				destinationNamespace:  tc.destinationNamespace,
+				destinationTag:        tc.destinationTag,
+				pruneRemovedTags:      tc.pruneRemovedTags,
+				deniedDigests:         func() sets.String { return tc.deniedDigests },
+				requester:             tc.requester,
+				importer:              importer,
+				scheduledImports:      tc.scheduledImports,
+				propagateSourceCommit: tc.propagateSourceCommit,
+				copySignatures:        tc.copySignatures,
+				copyTagAnnotations:    tc.copyTagAnnotations,
+				compareContentDigest:  tc.compareContentDigest,
+				skipNewerDestinations: tc.skipNewerDestinations,
+				propagatedImageLabels: tc.propagatedImageLabels,
+				minImageAge:           tc.minImageAge,
+
+				defaultReferencePolicy:   tc.defaultPolicy,
+				referencePolicies:        tc.referencePolicies,
+				pauseConfigMap:           tc.pauseConfigMap,
+				destinationTTL:           tc.destinationTTL,
+				releasePayloadAnnotation: tc.releasePayloadAnnotation,
+
+				skippedImportsCounter:   newSkippedImportsCounter(),
+				sourceImageAgeHistogram: newSourceImageAgeHistogram(),
+				importDurationHistogram: newImportDurationHistogram(),
+				clock:                   clock,
+			}
+
+			request := reconcile.Request{NamespacedName: tc.request}
+			wg := sync.WaitGroup{}
+			for _, concurrentRequest := range tc.concurrentRequests {
+				wg.Add(1)
+				go func(request reconcile.Request) {
+					defer wg.Done()
+					if _, err := r.reconcile(context.Background(), request, r.log.WithField("request", request.String())); err != nil {
+						t.Errorf("reconcile of concurrent request %s failed: %v", request, err)
+					}
+				}(reconcile.Request{NamespacedName: concurrentRequest})
+			}
+			// Like Reconcile, every reconciliation gets its own log entry because they get modified
+			action, err := r.reconcile(context.Background(), request, r.log.WithField("request", request.String()))
+			wg.Wait()
+			if err := tc.verify(r.registryClient, r.buildClusterClients, err); err != nil {
+				t.Errorf("verification failed: %v", err)
+			}
+			if action != tc.expectedAction {
+				t.Errorf("expected action %s, got %s", tc.expectedAction, action)
+			}
+			if tc.expectedSkipReason != "" {
+				cluster, _, err := decodeRequest(request)
+				if err != nil {
+					t.Fatalf("failed to decode request: %v", err)
+				}
+				if skipped := counterValue(t, r.skippedImportsCounter, cluster, tc.expectedSkipReason); skipped != 1 {
+					t.Errorf("expected one import skipped for reason %s, got %v", tc.expectedSkipReason, skipped)
+				}
+			}
+			if tc.expectedSourceImageAge != 0 {
+				count, sum := histogramValue(t, r.sourceImageAgeHistogram)
+				if count != 1 || sum != tc.expectedSourceImageAge.Seconds() {
+					t.Errorf("expected one observed source image age of %f, got %d with a sum of %f", tc.expectedSourceImageAge.Seconds(), count, sum)
+				}
+			}
+			if tc.importLatency != 0 {
+				cluster, _, err := decodeRequest(request)
+				if err != nil {
+					t.Fatalf("failed to decode request: %v", err)
+				}
+				count, sum := histogramValue(t, r.importDurationHistogram.WithLabelValues(cluster).(prometheus.Histogram))
+				if count != 1 || sum != tc.importLatency.Seconds() {
+					t.Errorf("expected one observed import duration of %f, got %d with a sum of %f", tc.importLatency.Seconds(), count, sum)
+				}
+			}
+		})
+	}
+}
+
+func histogramValue(t *testing.T, histogram prometheus.Histogram) (uint64, float64) {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := histogram.Write(metric); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
+
+func counterValue(t *testing.T, counter *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := counter.WithLabelValues(labels...).Write(metric); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+type recordingImporter struct {
+	imported []string
+	err      error
+}
+
+func (i *recordingImporter) Import(_ context.Context, cluster string, _ ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error {
+	for _, image := range imageStreamImport.Spec.Images {
+		i.imported = append(i.imported, fmt.Sprintf("%s: %s/%s: %s -> %s", cluster, imageStreamImport.Namespace, imageStreamImport.Name, image.From.Name, image.To.Name))
+	}
+	return i.err
+}
+
+func bcc(upstream ctrlruntimeclient.Client, opts ...func(*imageImportStatusSettingClient)) ctrlruntimeclient.Client {
+	c := &imageImportStatusSettingClient{
+		Client: upstream,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type imageImportStatusSettingClient struct {
+	ctrlruntimeclient.Client
+	failure bool
+	// hang makes the import block until the context is done, like a server
+	// that never returns a status would.
+	hang bool
+	// statuses are set as the status of the import if set
+	statuses []imagev1.ImageImportStatus
+}
+
+func (client *imageImportStatusSettingClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
+	if asserted, match := obj.(*imagev1.ImageStreamImport); match {
+		if client.hang {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		asserted.Status.Images = []imagev1.ImageImportStatus{{}}
+		if client.statuses != nil {
+			asserted.Status.Images = client.statuses
+		} else if client.failure {
+			asserted.Status.Images[0].Status.Message = "failing as requested"
+		} else {
+			asserted.Status.Images[0].Image = &imagev1.Image{}
+		}
+	}
+	return client.Client.Create(ctx, obj, opts...)
+}
+
+// staleImageStreamCacheClient simulates a cache that doesn't know about an imagestream
+// that already exists on the server
+type staleImageStreamCacheClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (client *staleImageStreamCacheClient) Get(ctx context.Context, key ctrlruntimeclient.ObjectKey, obj ctrlruntimeclient.Object) error {
+	if _, match := obj.(*imagev1.ImageStream); match {
+		return apierrors.NewNotFound(imagev1.Resource("imagestreams"), key.Name)
+	}
+	return client.Client.Get(ctx, key, obj)
+}
+
+func (client *staleImageStreamCacheClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
+	if _, match := obj.(*imagev1.ImageStream); match {
+		return apierrors.NewAlreadyExists(imagev1.Resource("imagestreams"), obj.GetName())
+	}
+	return client.Client.Create(ctx, obj, opts...)
+}
+
+// indexConfigsByTestInputImageStreamTag must be an agents.IndexFn
+var _ agents.IndexFn = indexConfigsByTestInputImageStreamTag(nil)
+
+func TestTestImageStramTagImportHandlerRoundTrips(t *testing.T) {
+	t.Parallel()
+	const cluster, namespace, name = "cluster", "namespace", "name"
+	obj := &testimagestreamtagimportv1.TestImageStreamTagImport{
+		Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
+			ClusterName: cluster,
+			Namespace:   namespace,
+			Name:        name,
+		},
+	}
+	queue := &hijackingQueue{}
+
+	event := event.CreateEvent{Object: obj}
+	testImageStreamTagImportHandler(logrus.NewEntry(logrus.StandardLogger()), sets.NewString()).Create(event, queue)
+
+	if n := len(queue.received); n != 1 {
+		t.Fatalf("expected exactly one reconcile request, got %d(%v)", n, queue.received)
+	}
+
+	actualCluster, namespacedName, err := decodeRequest(queue.received[0])
+	if err != nil {
+		t.Fatalf("error decoding request: %v", err)
+	}
+	if actualCluster != cluster {
+		t.Errorf("expected cluster to be %s, was %s", cluster, actualCluster)
+	}
+	if namespacedName.Namespace != namespace {
+		t.Errorf("expected namespace to be %s, was %s", namespace, namespacedName.Namespace)
+	}
+	if namespacedName.Name != name {
+		t.Errorf("expected name to be %s, was %s", name, namespacedName.Name)
+	}
+}
+
+func TestTestInputImageStreamTagFilterFactory(t *testing.T) {
+	t.Parallel()
+	const namespace, streamName, tagName = "namespace", "streamName", "streamTag"
+	testCases := []struct {
+		name                            string
+		config                          api.ReleaseBuildConfiguration
+		client                          ctrlruntimeclient.Client
+		buildClusterClients             map[string]ctrlruntimeclient.Client
+		additionalImageStreamTags       sets.String
+		additionalImageStreams          sets.String
+		additionalImageStreamNamespaces sets.String
+		namespaceGlobs                  []string
+		skipNamespacePatterns           []*regexp.Regexp
+		expectedResult                  bool
+		expectedReason                  string
+	}{
+		{
+			name:                      "imagestreamtag is explicitly allowed",
+			expectedReason:            "matched by additionalImageStreamTags",
+			additionalImageStreamTags: sets.NewString(namespace + "/" + streamName + ":" + tagName),
+			expectedResult:            true,
+		},
+		{
+			name:                   "imagestream is explicitly allowed",
+			expectedReason:         "matched by additionalImageStreams",
+			additionalImageStreams: sets.NewString(namespace + "/" + streamName),
+			expectedResult:         true,
+		},
+		{
+			name:                            "imagestream_namespace is explicitly allowed",
+			expectedReason:                  "matched by additionalImageStreamNamespaces",
+			additionalImageStreamNamespaces: sets.NewString(namespace),
+			expectedResult:                  true,
+		},
+		{
+			name:           "imagestream_namespace matches a glob",
+			expectedReason: "matched by namespaceGlobs",
+			namespaceGlobs: []string{"other-*", "name*"},
+			expectedResult: true,
+		},
+		{
+			name:           "imagestream_namespace doesn't match any glob",
+			expectedReason: "imagestreamtag is not referenced",
+			namespaceGlobs: []string{"other-*", "namespace-*"},
+		},
+		{
+			name:                            "skipped namespace is denied even if it is explicitly allowed",
+			expectedReason:                  "denied by skipNamespacePatterns",
+			additionalImageStreamTags:       sets.NewString(namespace + "/" + streamName + ":" + tagName),
+			additionalImageStreamNamespaces: sets.NewString(namespace),
+			namespaceGlobs:                  []string{"name*"},
+			skipNamespacePatterns:           []*regexp.Regexp{regexp.MustCompile("^other$"), regexp.MustCompile("^name")},
+		},
+		{
+			name:                            "namespace not matching any skip pattern is allowed",
+			expectedReason:                  "matched by additionalImageStreamNamespaces",
+			additionalImageStreamNamespaces: sets.NewString(namespace),
+			skipNamespacePatterns:           []*regexp.Regexp{regexp.MustCompile("^openshift-")},
+			expectedResult:                  true,
+		},
+		{
+			name:           "malformed glob never matches",
+			expectedReason: "imagestreamtag is not referenced",
+			namespaceGlobs: []string{"name[space"},
+		},
+		{
+			name:           "imagestreamtag is referenced by config",
+			expectedReason: "imagestreamtag is referenced by a ci-operator config",
+			config: api.ReleaseBuildConfiguration{
+				RawSteps: []api.StepConfiguration{
+					{
+						InputImageTagStepConfiguration: &api.InputImageTagStepConfiguration{
+							InputImage: api.InputImage{
+								BaseImage: api.MultiArchImageStreamTagReference{
+									ImageStreamTagReference: api.ImageStreamTagReference{Namespace: namespace, Name: streamName, Tag: tagName}},
+							},
+						},
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "imagestream is referenced by config",
+			expectedReason: "imagestream is referenced by a ci-operator config",
+			config: api.ReleaseBuildConfiguration{InputConfiguration: api.InputConfiguration{
+				ReleaseTagConfiguration: &api.ReleaseTagConfiguration{Namespace: namespace, Name: streamName},
+			}},
+			expectedResult: true,
+		},
+		{
+			name:           "imagestream is referenced by integration stream",
+			expectedReason: "imagestream is referenced by a ci-operator config",
+			config: api.ReleaseBuildConfiguration{
+				InputConfiguration: api.InputConfiguration{
+					Releases: map[string]api.UnresolvedRelease{
+						api.InitialReleaseName: {
+							Integration: &api.Integration{
+								Namespace: namespace,
+								Name:      streamName,
+							},
+						},
+						api.LatestReleaseName: {
+							Integration: &api.Integration{
+								Namespace:          namespace,
+								Name:               streamName,
+								IncludeBuiltImages: true,
+							},
+						},
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "imagestream is referenced by non-integration stream",
+			expectedReason: "imagestreamtag is not referenced",
+			config: api.ReleaseBuildConfiguration{
+				InputConfiguration: api.InputConfiguration{
+					Releases: map[string]api.UnresolvedRelease{
+						api.LatestReleaseName: {
+							Release: &api.Release{
+								Version:      "v",
+								Channel:      api.ReleaseChannelStable,
+								Architecture: api.ReleaseArchitectureAMD64,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:           "imagestreamtag is referenced by imagestreamtag import",
+			expectedReason: "imagestreamtag is referenced by a testimagestreamtagimport",
+			client: fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
+				Namespace: namespace,
+				Name:      streamName + ":" + tagName,
+			}}).WithImageStreamLabels()),
+			expectedResult: true,
+		},
+		{
+			name:           "imagestreamtag is referenced by imagestreatag import in a buildcluster",
+			expectedReason: "imagestreamtag is referenced by a testimagestreamtagimport",
+			buildClusterClients: map[string]ctrlruntimeclient.Client{"build01": fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{
+				Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
+					Namespace: namespace,
+					Name:      streamName + ":" + tagName,
+				}}).WithImageStreamLabels()),
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "imagestreamtag is referenced by imagestreatag import in a buildcluster, nil clients are skipped",
+			expectedReason: "imagestreamtag is referenced by a testimagestreamtagimport",
+			buildClusterClients: map[string]ctrlruntimeclient.Client{
+				"build01": nil,
+				"build02": fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{
+					Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
+						Namespace: namespace,
+						Name:      streamName + ":" + tagName,
+					}}).WithImageStreamLabels()),
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "no reference, imagestreatag gets denied",
+			expectedReason: "imagestreamtag is not referenced",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.client == nil {
+				tc.client = fakeclient.NewFakeClient()
+			}
+			if tc.buildClusterClients == nil {
+				tc.buildClusterClients = map[string]ctrlruntimeclient.Client{}
+			}
+			configAgent := agents.NewFakeConfigAgent(map[string]map[string][]api.ReleaseBuildConfiguration{"": {"": []api.ReleaseBuildConfiguration{tc.config}}})
+			filter, err := testInputImageStreamTagExplainingFilterFactory(
+				logrus.NewEntry(logrus.New()),
+				configAgent,
+				tc.client,
+				noOpRegistryResolver{},
+				tc.additionalImageStreamTags,
+				tc.additionalImageStreams,
+				tc.additionalImageStreamNamespaces,
+				tc.namespaceGlobs,
+				tc.skipNamespacePatterns,
+				false,
+				tc.buildClusterClients,
+			)
+			if err != nil {
+				t.Fatalf("failed to construct filter: %v", err)
+			}
+			result, reason := filter(types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName})
+			if result != tc.expectedResult {
+				t.Errorf("expected result %t, got result %t", tc.expectedResult, result)
+			}
+			if reason != tc.expectedReason {
+				t.Errorf("expected reason %q, got reason %q", tc.expectedReason, reason)
+			}
+		})
+	}
+}
+
+func TestTestInputImageStreamTagFilterFactoryDenyByDefault(t *testing.T) {
+	t.Parallel()
+	const namespace, streamName, tagName = "namespace", "streamName", "streamTag"
+	referencingConfig := api.ReleaseBuildConfiguration{InputConfiguration: api.InputConfiguration{
+		ReleaseTagConfiguration: &api.ReleaseTagConfiguration{Namespace: namespace, Name: streamName},
+	}}
+	testCases := []struct {
+		name                   string
+		tag                    types.NamespacedName
+		config                 api.ReleaseBuildConfiguration
+		additionalImageStreams sets.String
+		namespaceGlobs         []string
+		skipNamespacePatterns  []*regexp.Regexp
+		expectedAdditive       bool
+		expectedStrict         bool
+		expectedStrictReason   string
+	}{
+		{
+			name:                 "no rules select nothing in both modes",
+			tag:                  types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName},
+			expectedStrictReason: "not matched by any allow rule",
+		},
+		{
+			name:                 "reference by a config is only enough in additive mode",
+			tag:                  types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName},
+			config:               referencingConfig,
+			expectedAdditive:     true,
+			expectedStrictReason: "not matched by any allow rule",
+		},
+		{
+			name:                 "multiarch namespace is only enough in additive mode",
+			tag:                  types.NamespacedName{Namespace: "ci-arm64", Name: streamName + ":" + tagName},
+			expectedAdditive:     true,
+			expectedStrictReason: "not matched by any allow rule",
+		},
+		{
+			name:                   "explicitly allowed imagestream is selected in both modes",
+			tag:                    types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName},
+			additionalImageStreams: sets.NewString(namespace + "/" + streamName),
+			expectedAdditive:       true,
+			expectedStrict:         true,
+			expectedStrictReason:   "matched by additionalImageStreams",
+		},
+		{
+			name:                 "namespace matching a glob is selected in both modes",
+			tag:                  types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName},
+			namespaceGlobs:       []string{"name*"},
+			expectedAdditive:     true,
+			expectedStrict:       true,
+			expectedStrictReason: "matched by namespaceGlobs",
+		},
+		{
+			name:                  "deny rule wins over allow rule in both modes",
+			tag:                   types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName},
+			config:                referencingConfig,
+			namespaceGlobs:        []string{"name*"},
+			skipNamespacePatterns: []*regexp.Regexp{regexp.MustCompile("^name")},
+			expectedStrictReason:  "denied by skipNamespacePatterns",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			for _, denyByDefault := range []bool{false, true} {
+				configAgent := agents.NewFakeConfigAgent(map[string]map[string][]api.ReleaseBuildConfiguration{"": {"": []api.ReleaseBuildConfiguration{tc.config}}})
+				filter, err := testInputImageStreamTagExplainingFilterFactory(
+					logrus.NewEntry(logrus.New()),
+					configAgent,
+					fakeclient.NewFakeClient(),
+					noOpRegistryResolver{},
+					sets.NewString(),
+					tc.additionalImageStreams,
+					sets.NewString(),
+					tc.namespaceGlobs,
+					tc.skipNamespacePatterns,
+					denyByDefault,
+					map[string]ctrlruntimeclient.Client{},
+				)
+				if err != nil {
+					t.Fatalf("failed to construct filter: %v", err)
+				}
+				result, reason := filter(tc.tag)
+				if !denyByDefault {
+					if result != tc.expectedAdditive {
+						t.Errorf("additive mode: expected result %t, got result %t (%s)", tc.expectedAdditive, result, reason)
+					}
+					continue
+				}
+				if result != tc.expectedStrict {
+					t.Errorf("deny by default mode: expected result %t, got result %t", tc.expectedStrict, result)
+				}
+				if reason != tc.expectedStrictReason {
+					t.Errorf("deny by default mode: expected reason %q, got reason %q", tc.expectedStrictReason, reason)
+				}
+			}
+		})
+	}
+}
+
+var _ registryResolver = noOpRegistryResolver{}
+
+type noOpRegistryResolver struct{}
+
+func (noOpRegistryResolver) ResolveConfig(cfg api.ReleaseBuildConfiguration) (api.ReleaseBuildConfiguration, error) {
+	return cfg, nil
+}
+
+func TestSourceForConfigChangeChannel(t *testing.T) {
+	t.Parallel()
+
+	type requestWithCluster struct {
+		cluster string
+		request types.NamespacedName
+	}
+
+	buildClusters := sets.NewString("build01", "build02")
+	testCases := []struct {
+		name   string
+		change agents.IndexDelta
+		client ctrlruntimeclient.Client
+
+		expected []requestWithCluster
+	}{
+		{
+			name:   "Config was added, we trigger an event per cluster",
+			change: agents.IndexDelta{IndexKey: "namespace/name:tag", Added: []*api.ReleaseBuildConfiguration{{}}},
+
+			expected: []requestWithCluster{
+				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:tag"}},
+				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:tag"}},
+			},
+		},
+		{
+			name:   "Config was removed, we don't trigger an event",
+			change: agents.IndexDelta{IndexKey: "namespace/name:tag", Removed: []*api.ReleaseBuildConfiguration{{}}},
+		},
+		{
+			name:   "Config for imagestream was added, we trigger an event per cluster and tag",
+			change: agents.IndexDelta{IndexKey: "imagestream_namespace/name", Added: []*api.ReleaseBuildConfiguration{{}}},
+			client: fakeclient.NewFakeClient(&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "name"}, Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "foo"}, {Tag: "bar"}}}}),
+
+			expected: []requestWithCluster{
+				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:foo"}},
+				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:bar"}},
+				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:foo"}},
+				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:bar"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.client == nil {
+				tc.client = fakeclient.NewFakeClient()
 			}
 
-			request := reconcile.Request{NamespacedName: tc.request}
-			err := r.reconcile(context.Background(), request, r.log)
-			if err := tc.verify(r.registryClient, r.buildClusterClients, err); err != nil {
-				t.Errorf("verification failed: %v", err)
+			changeChannel := make(chan agents.IndexDelta)
+
+			source := sourceForConfigChangeChannel(buildClusters, tc.client, changeChannel)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			queue := &hijackingQueue{}
+
+			if err := source.InjectStopChannel(ctx.Done()); err != nil {
+				t.Fatalf("failed to inject stop channel into source: %v", err)
+			}
+			if err := source.Start(ctx, &handler.EnqueueRequestForObject{}, queue); err != nil {
+				t.Fatalf("failed to start source: %v", err)
+			}
+			changeChannel <- tc.change
+			close(changeChannel)
+
+			// The source copies the data from the input channel to the workqueue asynchronously
+			// and there is no way for us to properly synchronize that so instead we just wait.
+			// We can not poll because for negative testcases (expect no request) that would instanly
+			// succeed and later events won't make the test fail correctly.
+			time.Sleep(10 * time.Second)
+			queue.lock.Lock()
+			if len(queue.received) != len(tc.expected) {
+				t.Errorf("expected to get %d events, got %d", len(tc.expected), len(queue.received))
+			}
+
+			var actual []requestWithCluster
+			for _, request := range queue.received {
+				cluster, namespacedName, err := decodeRequest(request)
+				if err != nil {
+					t.Errorf("failed to decode request %s: %v", request, err)
+					continue
+				}
+				actual = append(actual, requestWithCluster{cluster: cluster, request: namespacedName})
+			}
+			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(requestWithCluster{})); diff != "" {
+				t.Errorf("expected requests differ from actual: %s", diff)
 			}
+
 		})
 	}
 }
 
-func bcc(upstream ctrlruntimeclient.Client, opts ...func(*imageImportStatusSettingClient)) ctrlruntimeclient.Client {
-	c := &imageImportStatusSettingClient{
-		Client: upstream,
+func TestSplitImageStreamTagName(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		in             string
+		expectedStream string
+		expectedTag    string
+		expectedErr    string
+	}{
+		{
+			name:           "valid name",
+			in:             "applyconfig:latest",
+			expectedStream: "applyconfig",
+			expectedTag:    "latest",
+		},
+		{
+			name:        "name without colon",
+			in:          "applyconfig",
+			expectedErr: `imagestreamtag name "applyconfig" is not in stream:tag format: splitting it by ` + "`:`" + ` didn't yield two but 1 results`,
+		},
+		{
+			name:        "name with two colons",
+			in:          "applyconfig:latest:again",
+			expectedErr: `imagestreamtag name "applyconfig:latest:again" is not in stream:tag format: splitting it by ` + "`:`" + ` didn't yield two but 3 results`,
+		},
 	}
-	for _, opt := range opts {
-		opt(c)
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			stream, tag, err := splitImageStreamTagName(tc.in)
+			var actualErr string
+			if err != nil {
+				actualErr = err.Error()
+			}
+			if diff := cmp.Diff(tc.expectedErr, actualErr); diff != "" {
+				t.Errorf("expected error differs from actual: %s", diff)
+			}
+			if stream != tc.expectedStream {
+				t.Errorf("expected stream %q, got %q", tc.expectedStream, stream)
+			}
+			if tag != tc.expectedTag {
+				t.Errorf("expected tag %q, got %q", tc.expectedTag, tag)
+			}
+		})
 	}
-	return c
 }
 
-type imageImportStatusSettingClient struct {
-	ctrlruntimeclient.Client
-	failure bool
+func TestIsImportForbidden(t *testing.T) {
+	t.Parallel()
+	forbiddenRegistries := sets.NewString("registry.svc.ci.openshift.org", "registry.build01.ci.openshift.org:443", "[::1]", "quay.io:443/openshift/ci")
+	testCases := []struct {
+		name     string
+		pullSpec string
+		expected bool
+	}{
+		{
+			name:     "forbidden registry",
+			pullSpec: "registry.svc.ci.openshift.org/ci/applyconfig@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "forbidden registry referenced with port",
+			pullSpec: "registry.svc.ci.openshift.org:5000/ci/applyconfig@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "forbidden registry with port referenced without port",
+			pullSpec: "registry.build01.ci.openshift.org/ci/applyconfig@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "allowed registry",
+			pullSpec: "registry.ci.openshift.org/ci/applyconfig@sha256:abc",
+		},
+		{
+			name:     "registry that merely shares a prefix with a forbidden one",
+			pullSpec: "registry.svc.ci.openshift.org.example.com/ci/applyconfig@sha256:abc",
+		},
+		{
+			name:     "forbidden IPv6 registry referenced with port",
+			pullSpec: "[::1]:5000/ci/applyconfig@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "forbidden IPv6 registry referenced without port",
+			pullSpec: "[::1]/ci/applyconfig@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "allowed IPv6 registry",
+			pullSpec: "[::2]:5000/ci/applyconfig@sha256:abc",
+		},
+		{
+			name:     "repository under a forbidden registry path",
+			pullSpec: "quay.io/openshift/ci@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "repository under a forbidden registry path referenced with another port",
+			pullSpec: "quay.io:5000/openshift/ci-artifacts@sha256:abc",
+			expected: true,
+		},
+		{
+			name:     "repository outside of a forbidden registry path",
+			pullSpec: "quay.io/openshift/release@sha256:abc",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if actual := isImportForbidden(tc.pullSpec, forbiddenRegistries); actual != tc.expected {
+				t.Errorf("expected import to be forbidden: %t, got %t", tc.expected, actual)
+			}
+		})
+	}
 }
 
-func (client *imageImportStatusSettingClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
-	if asserted, match := obj.(*imagev1.ImageStreamImport); match {
-		asserted.Status.Images = []imagev1.ImageImportStatus{{}}
-		if client.failure {
-			asserted.Status.Images[0].Status.Message = "failing as requested"
-		} else {
-			asserted.Status.Images[0].Image = &imagev1.Image{}
-		}
+func TestImagestreamCopiesAnnotationsByPrefix(t *testing.T) {
+	t.Parallel()
+	source := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ci",
+			Name:      "applyconfig",
+			Annotations: map[string]string{
+				"release.openshift.io/config":              "config",
+				"release.openshift.io/rewrite":             "true",
+				"ci.openshift.io/owner":                    "dptp",
+				"openshift.io/image.dockerRepositoryCheck": "2021-01-01T00:00:00Z",
+			},
+		},
+	}
+	prefixes := []string{"release.openshift.io/", "ci.openshift.io/"}
+	stream, mutateFn := imagestream(source, "ci", prefixes, prefixes, "ci.openshift.io/managed-by", true, imagev1.LocalTagReferencePolicy)
+	if err := mutateFn(); err != nil {
+		t.Fatalf("mutateFn failed: %v", err)
+	}
+	expected := map[string]string{
+		"release.openshift.io/config":  "config",
+		"release.openshift.io/rewrite": "true",
+		"ci.openshift.io/owner":        "dptp",
+		"ci.openshift.io/managed-by":   ControllerName,
+	}
+	if diff := cmp.Diff(expected, stream.Annotations); diff != "" {
+		t.Errorf("annotations differ from expected: %s", diff)
 	}
-	return client.Client.Create(ctx, obj, opts...)
 }
 
-// indexConfigsByTestInputImageStreamTag must be an agents.IndexFn
-var _ agents.IndexFn = indexConfigsByTestInputImageStreamTag(nil)
+func TestImageStreamImportError(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		statuses []imagev1.ImageImportStatus
+		expected error
+	}{
+		{
+			name:     "image for the tag got imported",
+			statuses: []imagev1.ImageImportStatus{{Tag: "latest", Image: &imagev1.Image{}}},
+		},
+		{
+			name:     "image without a tag got imported",
+			statuses: []imagev1.ImageImportStatus{{Image: &imagev1.Image{}}},
+		},
+		{
+			name: "image for the tag got imported, failures of others are ignored",
+			statuses: []imagev1.ImageImportStatus{
+				{Tag: "other", Status: metav1.Status{Reason: metav1.StatusReasonNotFound, Message: "not found"}},
+				{Tag: "latest", Image: &imagev1.Image{}},
+			},
+		},
+		{
+			name:     "no statuses",
+			expected: errors.New("imageStreamImport did not succeed: no image status was returned"),
+		},
+		{
+			name:     "only other images got imported",
+			statuses: []imagev1.ImageImportStatus{{Tag: "other", Image: &imagev1.Image{}}},
+			expected: errors.New("imageStreamImport did not succeed: no image status was returned for tag latest"),
+		},
+		{
+			name: "all failed images are listed",
+			statuses: []imagev1.ImageImportStatus{
+				{Tag: "other", Status: metav1.Status{Reason: metav1.StatusReasonNotFound, Message: "not found"}},
+				{Tag: "imported", Image: &imagev1.Image{}},
+				{Tag: "latest", Status: metav1.Status{Reason: metav1.StatusReasonUnauthorized, Message: "authentication required"}},
+			},
+			expected: errors.New("imageStreamImport did not succeed: tag other: reason: NotFound, message: not found; tag latest: reason: Unauthorized, message: authentication required"),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			actual := imageStreamImportError(tc.statuses, "latest")
+			if diff := cmp.Diff(tc.expected, actual, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("error differs from expected: %s", diff)
+			}
+		})
+	}
+}
 
-func TestTestImageStramTagImportHandlerRoundTrips(t *testing.T) {
+func TestPinnedDigest(t *testing.T) {
 	t.Parallel()
-	const cluster, namespace, name = "cluster", "namespace", "name"
-	obj := &testimagestreamtagimportv1.TestImageStreamTagImport{
-		Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
-			ClusterName: cluster,
-			Namespace:   namespace,
-			Name:        name,
+	const digest = "sha256:328d0a90295ef5f5932807bcab8f230007afeb1572d1d7878ab8bdae671dfa8b"
+	testCases := []struct {
+		name          string
+		tags          []imagev1.TagReference
+		expected      string
+		expectedError error
+	}{
+		{
+			name: "no tags",
+		},
+		{
+			name: "tag is not pinned",
+			tags: []imagev1.TagReference{{Name: "latest"}},
+		},
+		{
+			name: "other tag is pinned",
+			tags: []imagev1.TagReference{{Name: "other", Annotations: map[string]string{pinAnnotation: digest}}},
+		},
+		{
+			name:     "tag is pinned",
+			tags:     []imagev1.TagReference{{Name: "other"}, {Name: "latest", Annotations: map[string]string{pinAnnotation: digest}}},
+			expected: digest,
+		},
+		{
+			name:          "pin is not a digest",
+			tags:          []imagev1.TagReference{{Name: "latest", Annotations: map[string]string{pinAnnotation: "v1.0"}}},
+			expectedError: errors.New(`dptp.openshift.io/pin annotation "v1.0" on tag latest is not a sha256 digest`),
 		},
 	}
-	queue := &hijackingQueue{}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := pinnedDigest(&imagev1.ImageStream{Spec: imagev1.ImageStreamSpec{Tags: tc.tags}}, "latest")
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("error differs from expected: %s", diff)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected pinned digest %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
 
-	event := event.CreateEvent{Object: obj}
-	testImageStreamTagImportHandler(logrus.NewEntry(logrus.StandardLogger()), sets.NewString()).Create(event, queue)
+func TestEnsureCABundle(t *testing.T) {
+	t.Parallel()
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "registry-ca"},
+		Data:       map[string]string{"ca-bundle.crt": "my-ca"},
+	}
+	sourceName := &types.NamespacedName{Namespace: "ci", Name: "registry-ca"}
+	testCases := []struct {
+		name           string
+		caBundleSource *types.NamespacedName
+		client         ctrlruntimeclient.Client
+		expected       *corev1.ConfigMap
+		expectedError  error
+	}{
+		{
+			name:   "no CA source configured, nothing is done",
+			client: fakeclient.NewFakeClient(source.DeepCopy()),
+		},
+		{
+			name:           "CA bundle is created",
+			caBundleSource: sourceName,
+			client:         fakeclient.NewFakeClient(source.DeepCopy()),
+			expected: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: caBundleConfigMapName},
+				Data:       map[string]string{"ca-bundle.crt": "my-ca"},
+			},
+		},
+		{
+			name:           "outdated CA bundle is updated",
+			caBundleSource: sourceName,
+			client: fakeclient.NewFakeClient(source.DeepCopy(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: caBundleConfigMapName},
+				Data:       map[string]string{"ca-bundle.crt": "old-ca"},
+			}),
+			expected: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: caBundleConfigMapName},
+				Data:       map[string]string{"ca-bundle.crt": "my-ca"},
+			},
+		},
+		{
+			name:           "missing CA source is an error",
+			caBundleSource: sourceName,
+			client:         fakeclient.NewFakeClient(),
+			expectedError:  errors.New(`failed to get the source configmap ci/registry-ca: configmaps "registry-ca" not found`),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := &reconciler{caBundleSource: tc.caBundleSource}
+			err := r.ensureCABundle(context.Background(), "ns", tc.client, logrus.NewEntry(logrus.StandardLogger()))
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Fatalf("error differs from expected: %s", diff)
+			}
+			actual := &corev1.ConfigMap{}
+			if err := tc.client.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: caBundleConfigMapName}, actual); err != nil {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("failed to get configmap: %v", err)
+				}
+				actual = nil
+			}
+			if diff := cmp.Diff(tc.expected, actual, testhelper.RuntimeObjectIgnoreRvTypeMeta); diff != "" {
+				t.Errorf("CA bundle differs from expected: %s", diff)
+			}
+		})
+	}
+}
 
-	if n := len(queue.received); n != 1 {
-		t.Fatalf("expected exactly one reconcile request, got %d(%v)", n, queue.received)
+func TestEnsureImageStream(t *testing.T) {
+	t.Parallel()
+	managed := map[string]string{defaultManagedByAnnotation: ControllerName}
+	testCases := []struct {
+		name        string
+		source      *imagev1.ImageStream
+		destination *imagev1.ImageStream
+		r           *reconciler
+
+		expectedLocalLookup bool
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "local lookup is enabled by default",
+			source:              &imagev1.ImageStream{Spec: imagev1.ImageStreamSpec{LookupPolicy: imagev1.ImageLookupPolicy{Local: true}}},
+			r:                   &reconciler{},
+			expectedLocalLookup: true,
+			expectedAnnotations: managed,
+		},
+		{
+			name:                "local lookup is disabled",
+			source:              &imagev1.ImageStream{Spec: imagev1.ImageStreamSpec{LookupPolicy: imagev1.ImageLookupPolicy{Local: true}}},
+			r:                   &reconciler{disableLocalLookup: true},
+			expectedAnnotations: managed,
+		},
+		{
+			name:                "configured managed-by annotation is set",
+			source:              &imagev1.ImageStream{},
+			r:                   &reconciler{managedByAnnotation: "example.com/managed-by"},
+			expectedLocalLookup: true,
+			expectedAnnotations: map[string]string{"example.com/managed-by": ControllerName},
+		},
+		{
+			name:                "annotations that got copied before are removed when copying is disabled",
+			source:              &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"release.openshift.io/config": "config"}}},
+			destination:         &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"release.openshift.io/config": "copied-before"}}},
+			r:                   &reconciler{disableAnnotationCopying: true},
+			expectedLocalLookup: true,
+			expectedAnnotations: managed,
+		},
+		{
+			name:   "annotations that are not managed survive when copying is disabled",
+			source: &imagev1.ImageStream{},
+			destination: &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				"release.openshift.io/config": "copied-before",
+				"example.com/owner":           "someone-else",
+				expiresAtAnnotation:           "2026-10-16T00:00:00Z",
+			}}},
+			r:                   &reconciler{disableAnnotationCopying: true},
+			expectedLocalLookup: true,
+			expectedAnnotations: map[string]string{
+				defaultManagedByAnnotation: ControllerName,
+				"example.com/owner":        "someone-else",
+				expiresAtAnnotation:        "2026-10-16T00:00:00Z",
+			},
+		},
+		{
+			name:                "disabled lookup policy of the source is propagated",
+			source:              &imagev1.ImageStream{},
+			destination:         &imagev1.ImageStream{Spec: imagev1.ImageStreamSpec{LookupPolicy: imagev1.ImageLookupPolicy{Local: true}}},
+			r:                   &reconciler{propagateLookupPolicy: true},
+			expectedAnnotations: managed,
+		},
+		{
+			name:                "enabled lookup policy of the source is propagated",
+			source:              &imagev1.ImageStream{Spec: imagev1.ImageStreamSpec{LookupPolicy: imagev1.ImageLookupPolicy{Local: true}}},
+			destination:         &imagev1.ImageStream{},
+			r:                   &reconciler{propagateLookupPolicy: true},
+			expectedLocalLookup: true,
+			expectedAnnotations: managed,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			name := types.NamespacedName{Namespace: "ci", Name: "applyconfig"}
+			tc.source.Namespace, tc.source.Name = name.Namespace, name.Name
+			var objects []runtime.Object
+			if tc.destination != nil {
+				tc.destination.Namespace, tc.destination.Name = name.Namespace, name.Name
+				objects = append(objects, tc.destination)
+			}
+			client := fakeclient.NewFakeClient(objects...)
+			if err := tc.r.ensureImageStream(context.Background(), tc.source, name.Namespace, imagev1.LocalTagReferencePolicy, client, logrus.NewEntry(logrus.StandardLogger())); err != nil {
+				t.Fatalf("failed to ensure imagestream: %v", err)
+			}
+			actual := &imagev1.ImageStream{}
+			if err := client.Get(context.Background(), name, actual); err != nil {
+				t.Fatalf("failed to get imagestream: %v", err)
+			}
+			if actual.Spec.LookupPolicy.Local != tc.expectedLocalLookup {
+				t.Errorf("expected local lookup to be %t, was %t", tc.expectedLocalLookup, actual.Spec.LookupPolicy.Local)
+			}
+			if diff := cmp.Diff(tc.expectedAnnotations, actual.Annotations); diff != "" {
+				t.Errorf("annotations differ from expected: %s", diff)
+			}
+		})
+	}
+}
+
+// noOpRegistryAgent only implements ResolveConfig, everything else panics
+type noOpRegistryAgent struct {
+	agents.RegistryAgent
+}
+
+func (noOpRegistryAgent) ResolveConfig(cfg api.ReleaseBuildConfiguration) (api.ReleaseBuildConfiguration, error) {
+	return cfg, nil
+}
+
+func TestListMatchingTags(t *testing.T) {
+	t.Parallel()
+	registryClient := fakeclient.NewFakeClient(
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "referenced"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}, {Tag: "unreferenced"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "additional"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "a"}, {Tag: "b"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "always", Name: "anything"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci-op-1234", Name: "pipeline"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "src"}}},
+		},
+		&imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "unreferenced"},
+			Status:     imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "latest"}, {Tag: "imported"}}},
+		},
+	)
+	buildClusterClient := &importListCountingClient{Client: fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci-op-5678", Name: "imported"},
+		Spec:       testimagestreamtagimportv1.TestImageStreamTagImportSpec{Namespace: "other", Name: "unreferenced:imported"},
+	}).WithImageStreamLabels())}
+	config := api.ReleaseBuildConfiguration{
+		RawSteps: []api.StepConfiguration{{
+			InputImageTagStepConfiguration: &api.InputImageTagStepConfiguration{
+				InputImage: api.InputImage{
+					BaseImage: api.MultiArchImageStreamTagReference{
+						ImageStreamTagReference: api.ImageStreamTagReference{Namespace: "ci", Name: "referenced", Tag: "latest"}},
+				},
+			},
+		}},
+	}
+	params := FilterParams{
+		ConfigAgent:                     agents.NewFakeConfigAgent(map[string]map[string][]api.ReleaseBuildConfiguration{"": {"": []api.ReleaseBuildConfiguration{config}}}),
+		Resolver:                        noOpRegistryAgent{},
+		AdditionalImageStreams:          sets.NewString("ci/additional"),
+		AdditionalImageStreamNamespaces: sets.NewString("always"),
+		NamespaceGlobs:                  []string{"ci-op-*"},
+		BuildClusterClients:             map[string]ctrlruntimeclient.Client{"build01": buildClusterClient},
 	}
 
-	actualCluster, namespacedName, err := decodeRequest(queue.received[0])
+	actual, err := ListMatchingTags(context.Background(), registryClient, params)
 	if err != nil {
-		t.Fatalf("error decoding request: %v", err)
+		t.Fatalf("failed to list matching tags: %v", err)
 	}
-	if actualCluster != cluster {
-		t.Errorf("expected cluster to be %s, was %s", cluster, actualCluster)
+	expected := []types.NamespacedName{
+		{Namespace: "always", Name: "anything:latest"},
+		{Namespace: "ci", Name: "additional:a"},
+		{Namespace: "ci", Name: "additional:b"},
+		{Namespace: "ci", Name: "referenced:latest"},
+		{Namespace: "ci-op-1234", Name: "pipeline:src"},
+		{Namespace: "other", Name: "unreferenced:imported"},
 	}
-	if namespacedName.Namespace != namespace {
-		t.Errorf("expected namespace to be %s, was %s", namespace, namespacedName.Namespace)
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("matching tags differ from expected: %s", diff)
 	}
-	if namespacedName.Name != name {
-		t.Errorf("expected name to be %s, was %s", name, namespacedName.Name)
+	// The unreferenced tags in the ci and other namespaces get looked up, one list per namespace
+	if buildClusterClient.lists != 2 {
+		t.Errorf("expected two lists of testimagestreamtagimports, got %d", buildClusterClient.lists)
 	}
 }
 
-func TestTestInputImageStreamTagFilterFactory(t *testing.T) {
+// importListCountingClient counts the lists of testimagestreamtagimports
+type importListCountingClient struct {
+	ctrlruntimeclient.Client
+	lists int
+}
+
+func (client *importListCountingClient) List(ctx context.Context, list ctrlruntimeclient.ObjectList, opts ...ctrlruntimeclient.ListOption) error {
+	if _, isImportList := list.(*testimagestreamtagimportv1.TestImageStreamTagImportList); isImportList {
+		client.lists++
+	}
+	return client.Client.List(ctx, list, opts...)
+}
+
+// erroringGetClient returns err for all Get calls
+type erroringGetClient struct {
+	ctrlruntimeclient.Client
+	err error
+}
+
+func (client *erroringGetClient) Get(_ context.Context, _ ctrlruntimeclient.ObjectKey, _ ctrlruntimeclient.Object) error {
+	return client.err
+}
+
+func TestValidateBuildClusters(t *testing.T) {
 	t.Parallel()
-	const namespace, streamName, tagName = "namespace", "streamName", "streamTag"
 	testCases := []struct {
-		name                            string
-		config                          api.ReleaseBuildConfiguration
-		client                          ctrlruntimeclient.Client
-		buildClusterClients             map[string]ctrlruntimeclient.Client
-		additionalImageStreamTags       sets.String
-		additionalImageStreams          sets.String
-		additionalImageStreamNamespaces sets.String
-		expectedResult                  bool
+		name               string
+		buildClusters      []string
+		ignoreClusterNames sets.String
+		minimum            int
+		expected           error
 	}{
 		{
-			name:                      "imagestreamtag is explicitly allowed",
-			additionalImageStreamTags: sets.NewString(namespace + "/" + streamName + ":" + tagName),
-			expectedResult:            true,
-		},
-		{
-			name:                   "imagestream is explicitly allowed",
-			additionalImageStreams: sets.NewString(namespace + "/" + streamName),
-			expectedResult:         true,
-		},
-		{
-			name:                            "imagestream_namespace is explicitly allowed",
-			additionalImageStreamNamespaces: sets.NewString(namespace),
-			expectedResult:                  true,
+			name:          "enough build clusters",
+			buildClusters: []string{"build01", "build02"},
+			minimum:       1,
 		},
 		{
-			name: "imagestreamtag is referenced by config",
-			config: api.ReleaseBuildConfiguration{
-				RawSteps: []api.StepConfiguration{
-					{
-						InputImageTagStepConfiguration: &api.InputImageTagStepConfiguration{
-							InputImage: api.InputImage{
-								BaseImage: api.MultiArchImageStreamTagReference{
-									ImageStreamTagReference: api.ImageStreamTagReference{Namespace: namespace, Name: streamName, Tag: tagName}},
-							},
-						},
-					},
-				},
-			},
-			expectedResult: true,
+			name:     "no build clusters",
+			minimum:  1,
+			expected: errors.New("need at least 1 build cluster(s) to distribute to, got 0: []"),
 		},
 		{
-			name: "imagestream is referenced by config",
-			config: api.ReleaseBuildConfiguration{InputConfiguration: api.InputConfiguration{
-				ReleaseTagConfiguration: &api.ReleaseTagConfiguration{Namespace: namespace, Name: streamName},
-			}},
-			expectedResult: true,
+			name:               "all build clusters are ignored or disabled",
+			buildClusters:      []string{"api.ci", "build01"},
+			ignoreClusterNames: sets.NewString("build01"),
+			minimum:            1,
+			expected:           errors.New("need at least 1 build cluster(s) to distribute to, got 0: []"),
 		},
 		{
-			name: "imagestream is referenced by integration stream",
-			config: api.ReleaseBuildConfiguration{
-				InputConfiguration: api.InputConfiguration{
-					Releases: map[string]api.UnresolvedRelease{
-						api.InitialReleaseName: {
-							Integration: &api.Integration{
-								Namespace: namespace,
-								Name:      streamName,
-							},
-						},
-						api.LatestReleaseName: {
-							Integration: &api.Integration{
-								Namespace:          namespace,
-								Name:               streamName,
-								IncludeBuiltImages: true,
-							},
-						},
-					},
-				},
-			},
-			expectedResult: true,
+			name:          "configured minimum is not reached",
+			buildClusters: []string{"build01"},
+			minimum:       2,
+			expected:      errors.New("need at least 2 build cluster(s) to distribute to, got 1: [build01]"),
 		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			managers := map[string]manager.Manager{}
+			for _, cluster := range tc.buildClusters {
+				managers[cluster] = nil
+			}
+			err := validateBuildClusters(managers, tc.ignoreClusterNames, tc.minimum)
+			if diff := cmp.Diff(tc.expected, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("error differs from expected: %s", diff)
+			}
+		})
+	}
+}
+
+// concurrentNamespaceCreationClient simulates a namespace that gets created by someone else
+// between our Get and Create
+type concurrentNamespaceCreationClient struct {
+	ctrlruntimeclient.Client
+	lock    sync.Mutex
+	created bool
+}
+
+func (client *concurrentNamespaceCreationClient) Get(ctx context.Context, key ctrlruntimeclient.ObjectKey, obj ctrlruntimeclient.Object) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if _, match := obj.(*corev1.Namespace); match && !client.created {
+		return apierrors.NewNotFound(corev1.Resource("namespaces"), key.Name)
+	}
+	return client.Client.Get(ctx, key, obj)
+}
+
+func (client *concurrentNamespaceCreationClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if _, match := obj.(*corev1.Namespace); match {
+		concurrent := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: obj.GetName()}}
+		if err := client.Client.Create(ctx, concurrent); err != nil {
+			return err
+		}
+		client.created = true
+		return apierrors.NewAlreadyExists(corev1.Resource("namespaces"), obj.GetName())
+	}
+	return client.Client.Create(ctx, obj, opts...)
+}
+
+func TestReferencePolicyFor(t *testing.T) {
+	t.Parallel()
+	r := &reconciler{
+		defaultReferencePolicy:     imagev1.LocalTagReferencePolicy,
+		referencePolicies:          map[string]imagev1.TagReferencePolicyType{"build02": imagev1.SourceTagReferencePolicy},
+		namespaceReferencePolicies: map[string]imagev1.TagReferencePolicyType{"openshift": imagev1.SourceTagReferencePolicy, "ci-local": imagev1.LocalTagReferencePolicy},
+	}
+	testCases := []struct {
+		name      string
+		cluster   string
+		namespace string
+		expected  imagev1.TagReferencePolicyType
+	}{
 		{
-			name: "imagestream is referenced by non-integration stream",
-			config: api.ReleaseBuildConfiguration{
-				InputConfiguration: api.InputConfiguration{
-					Releases: map[string]api.UnresolvedRelease{
-						api.LatestReleaseName: {
-							Release: &api.Release{
-								Version:      "v",
-								Channel:      api.ReleaseChannelStable,
-								Architecture: api.ReleaseArchitectureAMD64,
-							},
-						},
-					},
-				},
-			},
+			name:      "namespace override wins over the global default",
+			cluster:   "build01",
+			namespace: "openshift",
+			expected:  imagev1.SourceTagReferencePolicy,
 		},
 		{
-			name: "imagestreamtag is referenced by imagestreamtag import",
-			client: fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
-				Namespace: namespace,
-				Name:      streamName + ":" + tagName,
-			}}).WithImageStreamLabels()),
-			expectedResult: true,
+			name:      "namespace override wins over the cluster override",
+			cluster:   "build02",
+			namespace: "ci-local",
+			expected:  imagev1.LocalTagReferencePolicy,
 		},
 		{
-			name: "imagestreamtag is referenced by imagestreatag import in a buildcluster",
-			buildClusterClients: map[string]ctrlruntimeclient.Client{"build01": fakeclient.NewFakeClient((&testimagestreamtagimportv1.TestImageStreamTagImport{
-				Spec: testimagestreamtagimportv1.TestImageStreamTagImportSpec{
-					Namespace: namespace,
-					Name:      streamName + ":" + tagName,
-				}}).WithImageStreamLabels()),
-			},
-			expectedResult: true,
+			name:      "cluster override applies without namespace override",
+			cluster:   "build02",
+			namespace: "ci",
+			expected:  imagev1.SourceTagReferencePolicy,
 		},
 		{
-			name: "no reference, imagestreatag gets denied",
+			name:      "global default applies without any override",
+			cluster:   "build01",
+			namespace: "ci",
+			expected:  imagev1.LocalTagReferencePolicy,
 		},
 	}
-
 	for _, tc := range testCases {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.client == nil {
-				tc.client = fakeclient.NewFakeClient()
-			}
-			if tc.buildClusterClients == nil {
-				tc.buildClusterClients = map[string]ctrlruntimeclient.Client{}
-			}
-			configAgent := agents.NewFakeConfigAgent(map[string]map[string][]api.ReleaseBuildConfiguration{"": {"": []api.ReleaseBuildConfiguration{tc.config}}})
-			filter, err := testInputImageStreamTagFilterFactory(
-				logrus.NewEntry(logrus.New()),
-				configAgent,
-				tc.client,
-				noOpRegistryResolver{},
-				tc.additionalImageStreamTags,
-				tc.additionalImageStreams,
-				tc.additionalImageStreamNamespaces,
-				tc.buildClusterClients,
-			)
-			if err != nil {
-				t.Fatalf("failed to construct filter: %v", err)
-			}
-			if result := filter(types.NamespacedName{Namespace: namespace, Name: streamName + ":" + tagName}); result != tc.expectedResult {
-				t.Errorf("expected result %t, got result %t", tc.expectedResult, result)
+			t.Parallel()
+			if actual := r.referencePolicyFor(tc.cluster, tc.namespace); actual != tc.expected {
+				t.Errorf("expected reference policy %s, got %s", tc.expected, actual)
 			}
 		})
 	}
 }
 
-var _ registryResolver = noOpRegistryResolver{}
-
-type noOpRegistryResolver struct{}
-
-func (noOpRegistryResolver) ResolveConfig(cfg api.ReleaseBuildConfiguration) (api.ReleaseBuildConfiguration, error) {
-	return cfg, nil
-}
-
-func TestSourceForConfigChangeChannel(t *testing.T) {
+func TestBuildImageStreamImport(t *testing.T) {
 	t.Parallel()
-
-	type requestWithCluster struct {
-		cluster string
-		request types.NamespacedName
+	source := &imagev1.ImageStreamTag{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig:latest"},
+		Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}, DockerImageReference: "quay.io/openshift/ci@sha256:abc"},
+	}
+	expectedImport := func(namespace, tag string, referencePolicy imagev1.TagReferencePolicyType, scheduled bool) *imagev1.ImageStreamImport {
+		return &imagev1.ImageStreamImport{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "applyconfig"},
+			Spec: imagev1.ImageStreamImportSpec{
+				Import: true,
+				Images: []imagev1.ImageImportSpec{{
+					From:            corev1.ObjectReference{Kind: "DockerImage", Name: "registry.ci.openshift.org/ci/applyconfig@sha256:abc"},
+					To:              &corev1.LocalObjectReference{Name: tag},
+					ReferencePolicy: imagev1.TagReferencePolicy{Type: referencePolicy},
+					ImportPolicy:    imagev1.TagImportPolicy{Scheduled: scheduled},
+				}},
+			},
+		}
 	}
-
-	buildClusters := sets.NewString("build01", "build02")
 	testCases := []struct {
-		name   string
-		change agents.IndexDelta
-		client ctrlruntimeclient.Client
-
-		expected []requestWithCluster
+		name          string
+		source        *imagev1.ImageStreamTag
+		opts          importOptions
+		expected      *imagev1.ImageStreamImport
+		expectedError error
 	}{
 		{
-			name:   "Config was added, we trigger an event per cluster",
-			change: agents.IndexDelta{IndexKey: "namespace/name:tag", Added: []*api.ReleaseBuildConfiguration{{}}},
-
-			expected: []requestWithCluster{
-				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:tag"}},
-				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:tag"}},
+			name:     "defaults import into the same namespace and tag",
+			source:   source,
+			opts:     importOptions{registryDomain: api.ServiceDomainAPPCIRegistry, referencePolicy: imagev1.LocalTagReferencePolicy},
+			expected: expectedImport("ci", "latest", imagev1.LocalTagReferencePolicy, false),
+		},
+		{
+			name:   "destination namespace is mapped per cluster",
+			source: source,
+			opts: importOptions{
+				registryDomain:       api.ServiceDomainAPPCIRegistry,
+				destinationNamespace: func(cluster, namespace string) string { return cluster + "-" + namespace },
+				referencePolicy:      imagev1.LocalTagReferencePolicy,
 			},
+			expected: expectedImport("build01-ci", "latest", imagev1.LocalTagReferencePolicy, false),
 		},
 		{
-			name:   "Config was removed, we don't trigger an event",
-			change: agents.IndexDelta{IndexKey: "namespace/name:tag", Removed: []*api.ReleaseBuildConfiguration{{}}},
+			name:   "destination tag is mapped",
+			source: source,
+			opts: importOptions{
+				registryDomain:  api.ServiceDomainAPPCIRegistry,
+				destinationTag:  func(tag string) string { return "mirrored-" + tag },
+				referencePolicy: imagev1.LocalTagReferencePolicy,
+			},
+			expected: expectedImport("ci", "mirrored-latest", imagev1.LocalTagReferencePolicy, false),
 		},
 		{
-			name:   "Config for imagestream was added, we trigger an event per cluster and tag",
-			change: agents.IndexDelta{IndexKey: "imagestream_namespace/name", Added: []*api.ReleaseBuildConfiguration{{}}},
-			client: fakeclient.NewFakeClient(&imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "name"}, Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{{Tag: "foo"}, {Tag: "bar"}}}}),
-
-			expected: []requestWithCluster{
-				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:foo"}},
-				{cluster: "build01", request: types.NamespacedName{Namespace: "namespace", Name: "name:bar"}},
-				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:foo"}},
-				{cluster: "build02", request: types.NamespacedName{Namespace: "namespace", Name: "name:bar"}},
+			name:     "reference policy and scheduled imports are applied",
+			source:   source,
+			opts:     importOptions{registryDomain: api.ServiceDomainAPPCIRegistry, referencePolicy: imagev1.SourceTagReferencePolicy, scheduled: true},
+			expected: expectedImport("ci", "latest", imagev1.SourceTagReferencePolicy, true),
+		},
+		{
+			name: "malformed name is an error",
+			source: &imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig"},
+				Image:      imagev1.Image{ObjectMeta: metav1.ObjectMeta{Name: "sha256:abc"}},
+			},
+			expectedError: errors.New("imagestreamtag name \"applyconfig\" is not in stream:tag format: splitting it by `:` didn't yield two but 1 results"),
+		},
+		{
+			name: "source image without name is an error",
+			source: &imagev1.ImageStreamTag{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "applyconfig:latest"},
 			},
+			expectedError: errors.New("source image not fully populated for tag ci/applyconfig:latest"),
 		},
 	}
-
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-
-			if tc.client == nil {
-				tc.client = fakeclient.NewFakeClient()
-			}
-
-			changeChannel := make(chan agents.IndexDelta)
-
-			source := sourceForConfigChangeChannel(buildClusters, tc.client, changeChannel)
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			queue := &hijackingQueue{}
-
-			if err := source.InjectStopChannel(ctx.Done()); err != nil {
-				t.Fatalf("failed to inject stop channel into source: %v", err)
+			actual, err := buildImageStreamImport("build01", tc.source, tc.opts)
+			if diff := cmp.Diff(tc.expectedError, err, testhelper.EquateErrorMessage); diff != "" {
+				t.Errorf("error differs from expected: %s", diff)
 			}
-			if err := source.Start(ctx, &handler.EnqueueRequestForObject{}, queue); err != nil {
-				t.Fatalf("failed to start source: %v", err)
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("import differs from expected: %s", diff)
 			}
-			changeChannel <- tc.change
-			close(changeChannel)
+		})
+	}
+}
 
-			// The source copies the data from the input channel to the workqueue asynchronously
-			// and there is no way for us to properly synchronize that so instead we just wait.
-			// We can not poll because for negative testcases (expect no request) that would instanly
-			// succeed and later events won't make the test fail correctly.
-			time.Sleep(10 * time.Second)
-			queue.lock.Lock()
-			if len(queue.received) != len(tc.expected) {
-				t.Errorf("expected to get %d events, got %d", len(tc.expected), len(queue.received))
-			}
+// clockSteppingImporter takes latency on the fake clock to import
+type clockSteppingImporter struct {
+	clock   *clocktesting.FakeClock
+	latency time.Duration
+}
 
-			var actual []requestWithCluster
-			for _, request := range queue.received {
-				cluster, namespacedName, err := decodeRequest(request)
-				if err != nil {
-					t.Errorf("failed to decode request %s: %v", request, err)
-					continue
-				}
-				actual = append(actual, requestWithCluster{cluster: cluster, request: namespacedName})
-			}
-			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(requestWithCluster{})); diff != "" {
-				t.Errorf("expected requests differ from actual: %s", diff)
-			}
+func (i clockSteppingImporter) Import(ctx context.Context, cluster string, client ctrlruntimeclient.Client, imageStreamImport *imagev1.ImageStreamImport) error {
+	i.clock.Step(i.latency)
+	return clientImporter{}.Import(ctx, cluster, client, imageStreamImport)
+}
 
-		})
+// conflictingImportClient returns a conflict for all ImageStreamImport creations
+type conflictingImportClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (client *conflictingImportClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
+	if imageStreamImport, ok := obj.(*imagev1.ImageStreamImport); ok {
+		return apierrors.NewConflict(imagev1.Resource("imagestreamimports"), imageStreamImport.Name, errors.New("another import is in progress"))
 	}
+	return client.Client.Create(ctx, obj, opts...)
 }
@@ -0,0 +1,28 @@
+package testimagesdistributor
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// uncachedConfigMapsClient reads configmaps from the apiserver rather than the cache. Only
+// a few of them are ever read, so caching them would mean keeping all configmaps of the
+// cluster in memory and acting on stale data until the informer synced.
+type uncachedConfigMapsClient struct {
+	ctrlruntimeclient.Client
+	reader ctrlruntimeclient.Reader
+}
+
+func newUncachedConfigMapsClient(mgr manager.Manager) ctrlruntimeclient.Client {
+	return &uncachedConfigMapsClient{Client: mgr.GetClient(), reader: mgr.GetAPIReader()}
+}
+
+func (c *uncachedConfigMapsClient) Get(ctx context.Context, key ctrlruntimeclient.ObjectKey, obj ctrlruntimeclient.Object) error {
+	if _, isConfigMap := obj.(*corev1.ConfigMap); isConfigMap {
+		return c.reader.Get(ctx, key, obj)
+	}
+	return c.Client.Get(ctx, key, obj)
+}
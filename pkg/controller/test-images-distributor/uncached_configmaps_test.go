@@ -0,0 +1,32 @@
+package testimagesdistributor
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUncachedConfigMapsClient(t *testing.T) {
+	t.Parallel()
+	name := types.NamespacedName{Namespace: "ci", Name: "object"}
+	meta := metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}
+	client := &uncachedConfigMapsClient{
+		Client: fakeclient.NewFakeClient(&corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"from": "cache"}}, &corev1.Secret{ObjectMeta: meta}),
+		reader: fakeclient.NewFakeClient(&corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"from": "apiserver"}}),
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := client.Get(context.Background(), name, configMap); err != nil {
+		t.Fatalf("failed to get configmap: %v", err)
+	}
+	if from := configMap.Data["from"]; from != "apiserver" {
+		t.Errorf("expected configmap to be read from the apiserver, got it from the %s", from)
+	}
+	if err := client.Get(context.Background(), name, &corev1.Secret{}); err != nil {
+		t.Errorf("expected secret to be read from the cache, got %v", err)
+	}
+}
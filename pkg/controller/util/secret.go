@@ -28,6 +28,11 @@ func EnsureImagePullSecret(ctx context.Context, namespace string, client ctrlrun
 	if err := client.Get(ctx, key, secret); err != nil {
 		return fmt.Errorf("failed to get the source secret %s: %w", key.String(), err)
 	}
+	// The source secret is populated asynchronously. Copying it while it is still empty
+	// would make the import fail with a confusing authentication error.
+	if len(secret.Data) == 0 {
+		return fmt.Errorf("pull secret not available yet: source secret %s has no data", key.String())
+	}
 	s, mutateFn := pullSecret(secret, namespace)
 	return upsertObject(ctx, client, s, mutateFn, log)
 }
@@ -98,6 +98,19 @@ func TestEnsureImagePullSecret(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:      "source secret has no data yet",
+			client:    fakeclient.NewFakeClient(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "registry-pull-credentials"}}),
+			namespace: "some-ns",
+			expected:  fmt.Errorf("pull secret not available yet: source secret ci/registry-pull-credentials has no data"),
+			verify: func(client ctrlruntimeclient.Client) error {
+				actualSecret := &corev1.Secret{}
+				if err := client.Get(ctx, types.NamespacedName{Name: "registry-pull-credentials", Namespace: "some-ns"}, actualSecret); !kerrors.IsNotFound(err) {
+					return fmt.Errorf("expected the secret not to be copied, got error %v", err)
+				}
+				return nil
+			},
+		},
 		{
 			name:      "attempt to copy to ci",
 			client:    fakeclient.NewFakeClient(),
@@ -115,7 +128,7 @@ func TestEnsureImagePullSecret(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			actual := EnsureImagePullSecret(ctx, tc.namespace, tc.client, logrus.WithField("tc.name", tc.name))
-			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+			if diff := cmp.Diff(tc.expected, actual, testhelper.EquateErrorMessage); diff != "" {
 				t.Errorf("actual does not match expected, diff: %s", diff)
 			}
 			if actual == nil && tc.verify != nil {